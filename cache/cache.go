@@ -0,0 +1,122 @@
+// Package cache caches the users, rooms and memberships read through the repositories, so the lookups made on every
+// request do not reach the database. The repositories are decorated to read through the cache, and to invalidate the
+// cached records they change.
+//
+// Only the records that do not change, or that are invalidated when they do, are cached. With the in-process store
+// every node has a cache of its own, a room changed on another node is served stale until its entry expires. The
+// redis store is shared by the nodes.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log/slog"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+const (
+	// DefaultTTL is how long a record is cached when no ttl is configured.
+	DefaultTTL = time.Minute
+
+	// invalidationTimeout limits the time spent on deleting the keys of the changed records.
+	invalidationTimeout = 2 * time.Second
+)
+
+// Store keeps the encoded records under their keys.
+type Store interface {
+	// Get returns the value of the key, ok is false if the key is not set or has expired.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+
+	// Set sets the value of the key, which expires after ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete deletes the keys, the keys which are not set are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Cache caches the records of the repositories decorated with it in the store.
+type Cache struct {
+	store   Store
+	ttl     time.Duration
+	lookups metrics.Counter
+	logger  *slog.Logger
+}
+
+// get decodes the record cached under the key into v, and reports whether it was found. The failures of the store
+// are logged and counted, the record is then read from the repository like it was not cached.
+func (c *Cache) get(ctx context.Context, entity, key string, v interface{}) bool {
+	value, ok, err := c.store.Get(ctx, key)
+	if err == nil && ok {
+		err = gob.NewDecoder(bytes.NewReader(value)).Decode(v)
+	}
+
+	switch {
+	case err != nil:
+		c.logger.WarnContext(ctx, "reading cache failed", "key", key, "err", err)
+		c.lookups.With("entity", entity, "result", "error").Add(1)
+		return false
+	case !ok:
+		c.lookups.With("entity", entity, "result", "miss").Add(1)
+		return false
+	default:
+		c.lookups.With("entity", entity, "result", "hit").Add(1)
+		return true
+	}
+}
+
+// set caches the record under the key. A record which could not be cached is read from the repository next time, so
+// the failure is only logged.
+func (c *Cache) set(ctx context.Context, key string, v interface{}) {
+	var value bytes.Buffer
+	err := gob.NewEncoder(&value).Encode(v)
+	if err == nil {
+		err = c.store.Set(ctx, key, value.Bytes(), c.ttl)
+	}
+
+	if err != nil {
+		c.logger.WarnContext(ctx, "writing cache failed", "key", key, "err", err)
+	}
+}
+
+// invalidate deletes the keys of the changed records. The records are changed already, so the keys are deleted even
+// if the request is cancelled. The entries which could not be deleted are served stale until they expire.
+func (c *Cache) invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), invalidationTimeout)
+	defer cancel()
+
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		c.logger.WarnContext(ctx, "invalidating cache failed", "keys", keys, "err", err, "ttl", c.ttl)
+	}
+}
+
+// The keys of the cached records.
+func userKey(userID string) string           { return "user:" + userID }
+func roomKey(roomID string) string           { return "room:" + roomID }
+func roomMembersKey(roomID string) string    { return "room-members:" + roomID }
+func memberKey(roomID, userID string) string { return "room-member:" + roomID + ":" + userID }
+
+// New returns a Cache keeping the records in the store for ttl, or DefaultTTL if it's not positive. The lookups are
+// counted by entity and result, which is either hit, miss or error.
+func New(store Store, ttl time.Duration, lookups metrics.Counter, logger *slog.Logger) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	if lookups == nil {
+		lookups = discard.NewCounter()
+	}
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Cache{store: store, ttl: ttl, lookups: lookups, logger: logger}
+}
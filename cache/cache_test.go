@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/inmem"
+	"github.com/iamsayantan/messagerooms/repositorytest"
+)
+
+func newRepositories(db *inmem.DB) repositorytest.Repositories {
+	c := New(NewLRUStore(0), 0, nil, nil)
+
+	return repositorytest.Repositories{
+		Users:      NewUserRepository(c, inmem.NewUserRepository(db)),
+		Rooms:      NewRoomRepository(c, inmem.NewRoomRepository(db)),
+		Messages:   inmem.NewMessageRepository(db),
+		UnitOfWork: NewUnitOfWork(c, inmem.NewUnitOfWork(db)),
+	}
+}
+
+func TestRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return newRepositories(inmem.NewDB())
+	})
+}
+
+func TestInvalidation(t *testing.T) {
+	ctx := t.Context()
+	repos := newRepositories(inmem.NewDB())
+
+	owner, err := repos.Users.Create(ctx, "alice", "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	member, err := repos.Users.Create(ctx, "bob", "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	room, err := repos.Rooms.Create(ctx, "general", *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	// the room and its members are cached before the user joins.
+	if _, err := repos.Rooms.Find(ctx, room.ID); err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if _, err := repos.Rooms.GetRoomMembers(ctx, *room); err != nil {
+		t.Fatalf("getting room members: %v", err)
+	}
+
+	err = repos.UnitOfWork.Do(ctx, func(tx messagerooms.Repositories) error {
+		return tx.Rooms.AddUserToRoom(ctx, *room, *member)
+	})
+	if err != nil {
+		t.Fatalf("adding user to room: %v", err)
+	}
+
+	found, err := repos.Rooms.Find(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.MemberCount != 1 {
+		t.Errorf("room member count after joining = %d, want 1", found.MemberCount)
+	}
+
+	members, err := repos.Rooms.GetRoomMembers(ctx, *room)
+	if err != nil {
+		t.Fatalf("getting room members: %v", err)
+	}
+
+	if len(members) != 1 || members[0].ID != member.ID {
+		t.Errorf("room members after joining = %+v, want only user %s", members, member.ID)
+	}
+
+	message, err := repos.Messages.PostMessage(ctx, *room, *member, "hello")
+	if err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	if err := repos.Rooms.RecordMessage(ctx, *room, *message); err != nil {
+		t.Fatalf("recording message: %v", err)
+	}
+
+	if found, err = repos.Rooms.Find(ctx, room.ID); err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.MessageCount != 1 {
+		t.Errorf("room message count after posting = %d, want 1", found.MessageCount)
+	}
+
+	if found.LastMessage == nil || found.LastMessage.ID != message.ID {
+		t.Errorf("room last message after posting = %+v, want message %s", found.LastMessage, message.ID)
+	}
+}
+
+func TestLRUStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUStore(2)
+
+	for _, key := range []string{"a", "b"} {
+		if err := store.Set(ctx, key, []byte(key), time.Minute); err != nil {
+			t.Fatalf("setting %s: %v", key, err)
+		}
+	}
+
+	// a is used more recently than b, which is evicted for c.
+	if _, ok, _ := store.Get(ctx, "a"); !ok {
+		t.Fatal("a is not found")
+	}
+
+	if err := store.Set(ctx, "c", []byte("c"), time.Minute); err != nil {
+		t.Fatalf("setting c: %v", err)
+	}
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := store.Get(ctx, key); ok != want {
+			t.Errorf("%s found = %v, want %v", key, ok, want)
+		}
+	}
+
+	if err := store.Set(ctx, "expired", []byte("expired"), -time.Second); err != nil {
+		t.Fatalf("setting expired: %v", err)
+	}
+
+	if _, ok, _ := store.Get(ctx, "expired"); ok {
+		t.Error("expired entry is found")
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultLRUSize is the number of entries kept by the in-process store when no size is configured.
+const DefaultLRUSize = 10000
+
+// lruEntry is an entry of the in-process store.
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// lruStore keeps the entries in process. Once it's full, the least recently used entry is evicted for a new one.
+type lruStore struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List               // order holds the entries, the most recently used first
+	entries map[string]*list.Element // entries are the elements of order keyed by their key
+}
+
+func (s *lruStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.remove(element)
+		return nil, false, nil
+	}
+
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (s *lruStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	if s.order.Len() > s.size {
+		s.remove(s.order.Back())
+	}
+
+	return nil
+}
+
+func (s *lruStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := s.entries[key]; ok {
+			s.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// remove removes the entry of the element, the lock must be held.
+func (s *lruStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*lruEntry).key)
+}
+
+// NewLRUStore returns the in-process Store keeping at most size entries, or DefaultLRUSize if it's not positive.
+func NewLRUStore(size int) Store {
+	if size <= 0 {
+		size = DefaultLRUSize
+	}
+
+	return &lruStore{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
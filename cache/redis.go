@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// redisKeyPrefix keeps the cached records apart from the other keys of the redis database.
+const redisKeyPrefix = "cache:"
+
+// redisStore keeps the entries in redis, so they are shared by the nodes.
+type redisStore struct {
+	pool *redis.Pool
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	value, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", redisKeyPrefix+key))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	_, err = redis.DoContext(conn, ctx, "SET", redisKeyPrefix+key, value, "PX", ttl.Milliseconds())
+	return err
+}
+
+func (s *redisStore) Delete(ctx context.Context, keys ...string) error {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, redisKeyPrefix+key)
+	}
+
+	_, err = redis.DoContext(conn, ctx, "DEL", args...)
+	return err
+}
+
+// NewRedisStore returns the Store keeping the entries in redis, with the connections of the pool.
+func NewRedisStore(pool *redis.Pool) Store {
+	return &redisStore{pool: pool}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// roomRepository caches the rooms, their members and the memberships checked before posting a message. The rooms
+// and their members are invalidated when a user joins or a message is posted. Only the users found in a room are
+// cached, as the members never leave their rooms.
+type roomRepository struct {
+	cache *Cache
+	next  messagerooms.RoomRepository
+	tx    *transaction
+}
+
+func (r *roomRepository) GetRoomMembers(ctx context.Context, room messagerooms.Room) ([]*messagerooms.User, error) {
+	if r.tx != nil {
+		return r.next.GetRoomMembers(ctx, room)
+	}
+
+	var users []*messagerooms.User
+	if r.cache.get(ctx, "room_members", roomMembersKey(room.ID), &users) {
+		return users, nil
+	}
+
+	users, err := r.next.GetRoomMembers(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.set(ctx, roomMembersKey(room.ID), users)
+	return users, nil
+}
+
+func (r *roomRepository) ListRoomMembers(ctx context.Context, room messagerooms.Room, after string, limit int) ([]*messagerooms.User, error) {
+	return r.next.ListRoomMembers(ctx, room, after, limit)
+}
+
+func (r *roomRepository) Create(ctx context.Context, name string, user messagerooms.User) (*messagerooms.Room, error) {
+	return r.next.Create(ctx, name, user)
+}
+
+func (r *roomRepository) Find(ctx context.Context, id string) (*messagerooms.Room, error) {
+	if r.tx != nil {
+		return r.next.Find(ctx, id)
+	}
+
+	var room messagerooms.Room
+	if r.cache.get(ctx, "room", roomKey(id), &room) {
+		return &room, nil
+	}
+
+	found, err := r.next.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.set(ctx, roomKey(id), found)
+	return found, nil
+}
+
+// Lookup reads the room found with Find when it is cached, it is more than what is looked up. The looked up rooms are
+// not cached themselves, looking them up is a single query already.
+func (r *roomRepository) Lookup(ctx context.Context, id string) (*messagerooms.Room, error) {
+	if r.tx != nil {
+		return r.next.Lookup(ctx, id)
+	}
+
+	var room messagerooms.Room
+	if r.cache.get(ctx, "room", roomKey(id), &room) {
+		return &room, nil
+	}
+
+	return r.next.Lookup(ctx, id)
+}
+
+func (r *roomRepository) FindAll(ctx context.Context, query messagerooms.RoomQuery) ([]*messagerooms.Room, error) {
+	return r.next.FindAll(ctx, query)
+}
+
+func (r *roomRepository) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) error {
+	if err := r.next.AddUserToRoom(ctx, room, user); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, roomKey(room.ID), roomMembersKey(room.ID))
+	return nil
+}
+
+// CheckUserExistsInRoom reads the cached memberships in the units of work too, like the users they can not change once
+// committed. The posted messages are checked in a unit of work.
+func (r *roomRepository) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (bool, error) {
+	var exists bool
+	if r.cache.get(ctx, "room_member", memberKey(room.ID, user.ID), &exists) {
+		return exists, nil
+	}
+
+	exists, err := r.next.CheckUserExistsInRoom(ctx, room, user)
+	if err != nil {
+		return false, err
+	}
+
+	if exists && r.tx == nil {
+		r.cache.set(ctx, memberKey(room.ID, user.ID), exists)
+	}
+
+	return exists, nil
+}
+
+func (r *roomRepository) RecordMessage(ctx context.Context, room messagerooms.Room, message messagerooms.Message) error {
+	if err := r.next.RecordMessage(ctx, room, message); err != nil {
+		return err
+	}
+
+	r.invalidate(ctx, roomKey(room.ID))
+	return nil
+}
+
+// invalidate invalidates the keys of the changed records, in a unit of work once it has ended.
+func (r *roomRepository) invalidate(ctx context.Context, keys ...string) {
+	if r.tx != nil {
+		r.tx.keys = append(r.tx.keys, keys...)
+		return
+	}
+
+	r.cache.invalidate(ctx, keys...)
+}
+
+// NewRoomRepository returns the RoomRepository reading the rooms, their members and the memberships through the
+// cache.
+func NewRoomRepository(c *Cache, next messagerooms.RoomRepository) messagerooms.RoomRepository {
+	return &roomRepository{cache: c, next: next}
+}
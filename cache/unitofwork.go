@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// transaction holds the keys of the records changed in a unit of work. The repositories of a unit of work do not
+// cache the records they read, the records may not be committed.
+type transaction struct {
+	keys []string
+}
+
+type unitOfWork struct {
+	cache *Cache
+	next  messagerooms.UnitOfWork
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(repos messagerooms.Repositories) error) error {
+	tx := &transaction{}
+	err := u.next.Do(ctx, func(repos messagerooms.Repositories) error {
+		return fn(messagerooms.Repositories{
+			Users:    &userRepository{cache: u.cache, next: repos.Users, tx: tx},
+			Rooms:    &roomRepository{cache: u.cache, next: repos.Rooms, tx: tx},
+			Messages: repos.Messages,
+		})
+	})
+
+	// the keys are invalidated once the changes are committed, so the records are not cached again before. They are
+	// invalidated on failures too, a commit may have failed after the changes were made.
+	u.cache.invalidate(ctx, tx.keys...)
+	return err
+}
+
+// NewUnitOfWork returns the UnitOfWork invalidating the records changed in the units of work of next once they end.
+func NewUnitOfWork(c *Cache, next messagerooms.UnitOfWork) messagerooms.UnitOfWork {
+	return &unitOfWork{cache: c, next: next}
+}
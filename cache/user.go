@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// userRepository caches the users found by id, which are looked up to authenticate every request. A user is
+// invalidated when it is updated, the users listed along with the rooms and their members stay cached until they
+// expire.
+type userRepository struct {
+	cache *Cache
+	next  messagerooms.UserRepository
+	tx    *transaction
+}
+
+func (u *userRepository) Create(ctx context.Context, nickname, password string) (*messagerooms.User, error) {
+	return u.next.Create(ctx, nickname, password)
+}
+
+// FindByID reads the cached users in the units of work too, they were committed once cached. The users found in a
+// unit of work are not cached, they may not be committed.
+func (u *userRepository) FindByID(ctx context.Context, id string) (*messagerooms.User, error) {
+	var user messagerooms.User
+	if u.cache.get(ctx, "user", userKey(id), &user) {
+		return &user, nil
+	}
+
+	found, err := u.next.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.tx == nil {
+		u.cache.set(ctx, userKey(id), found)
+	}
+
+	return found, nil
+}
+
+func (u *userRepository) Update(ctx context.Context, user messagerooms.User) error {
+	if err := u.next.Update(ctx, user); err != nil {
+		return err
+	}
+
+	// the user is invalidated once the unit of work ends, like the rooms.
+	if u.tx != nil {
+		u.tx.keys = append(u.tx.keys, userKey(user.ID))
+		return nil
+	}
+
+	u.cache.invalidate(ctx, userKey(user.ID))
+	return nil
+}
+
+func (u *userRepository) FindByNickname(ctx context.Context, nickname string) (*messagerooms.User, error) {
+	return u.next.FindByNickname(ctx, nickname)
+}
+
+// NewUserRepository returns the UserRepository reading the users found by id through the cache.
+func NewUserRepository(c *Cache, next messagerooms.UserRepository) messagerooms.UserRepository {
+	return &userRepository{cache: c, next: next}
+}
@@ -0,0 +1,60 @@
+package messagerooms
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of the errors returned by the repositories and the services, whatever the storage behind them. The
+// returned errors wrap one of them, so the callers tell them apart with errors.Is.
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned when a change conflicts with the stored data, like a nickname that is already taken.
+	ErrConflict = errors.New("conflict")
+
+	// ErrUnavailable is returned when the storage could not serve the request, like when the database can not be
+	// reached or the request timed out.
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+var (
+	// ErrUserNotFound is returned when no user is found with the given option.
+	ErrUserNotFound = newError(ErrNotFound, "user not found")
+
+	// ErrRoomNotFound is returned when we don't get the room in our data store.
+	ErrRoomNotFound = newError(ErrNotFound, "room not found")
+
+	// ErrMessageNotFound is returned when no message is found with the given message id.
+	ErrMessageNotFound = newError(ErrNotFound, "message not found")
+
+	// ErrNicknameTaken is returned when a user is created with the nickname of another user.
+	ErrNicknameTaken = newError(ErrConflict, "an user already exists with the nickname")
+
+	// ErrUserAlreadyMember is returned when user tries to join a room they are already part of.
+	ErrUserAlreadyMember = newError(ErrConflict, "user is already part of the room")
+)
+
+// Unavailable returns the failure of the storage as an ErrUnavailable error, keeping the failure as its cause.
+func Unavailable(err error) error {
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+// domainError is an error of one of the kinds, with a message of its own.
+type domainError struct {
+	kind    error
+	message string
+}
+
+func (e *domainError) Error() string {
+	return e.message
+}
+
+func (e *domainError) Unwrap() error {
+	return e.kind
+}
+
+func newError(kind error, message string) error {
+	return &domainError{kind: kind, message: message}
+}
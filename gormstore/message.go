@@ -0,0 +1,57 @@
+package gormstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+type messageRepository struct {
+	db *gorm.DB
+}
+
+func (m *messageRepository) PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error) {
+	id := uuid.NewV4()
+	msg := messagerooms.Message{
+		ID:          id.String(),
+		MessageText: messageText,
+		RoomID:      room.ID,
+		UserID:      user.ID,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := m.db.WithContext(ctx).Create(&msg).Error; err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	// refetching the message for loading the relations.
+	return m.GetMessage(ctx, msg.ID)
+}
+
+func (m *messageRepository) GetMessage(ctx context.Context, messageID string) (*messagerooms.Message, error) {
+	var msg messagerooms.Message
+	err := m.db.WithContext(ctx).Preload("CreatedBy").Where("id = ?", messageID).First(&msg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, messagerooms.ErrMessageNotFound
+	}
+
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &msg, nil
+}
+
+func (m *messageRepository) GetMessagesByRoom(ctx context.Context, room messagerooms.Room) ([]*messagerooms.Message, error) {
+	var messages []*messagerooms.Message
+	err := m.db.WithContext(ctx).Preload("CreatedBy").Where("room_id = ?", room.ID).Order("created_at DESC").Find(&messages).Error
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,211 @@
+package gormstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern, with the escape character given to the LIKE clauses.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+type roomRepository struct {
+	db              *gorm.DB
+	isDuplicatedKey func(err error) bool
+}
+
+func (r *roomRepository) GetRoomMembers(ctx context.Context, room messagerooms.Room) ([]*messagerooms.User, error) {
+	var users []*messagerooms.User
+	if err := r.db.WithContext(ctx).Model(&room).Association("Users").Find(&users); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return users, nil
+}
+
+func (r *roomRepository) ListRoomMembers(ctx context.Context, room messagerooms.Room, after string, limit int) ([]*messagerooms.User, error) {
+	query := r.db.WithContext(ctx).Select("users.*").
+		Joins("INNER JOIN room_users ON room_users.user_id = users.id").
+		Where("room_users.room_id = ?", room.ID)
+
+	if after != "" {
+		query = query.Where("users.nickname > ?", after)
+	}
+
+	var users []*messagerooms.User
+	if err := query.Order("users.nickname").Limit(limit).Find(&users).Error; err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return users, nil
+}
+
+func (r *roomRepository) Create(ctx context.Context, name string, user messagerooms.User) (*messagerooms.Room, error) {
+	id := uuid.NewV4()
+	room := messagerooms.Room{
+		ID:       id.String(),
+		RoomName: name,
+		UserID:   user.ID,
+	}
+
+	if err := r.db.WithContext(ctx).Create(&room).Error; err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &room, nil
+}
+
+func (r *roomRepository) Find(ctx context.Context, id string) (*messagerooms.Room, error) {
+	room := messagerooms.Room{}
+	err := r.db.WithContext(ctx).Preload("CreatedBy").Preload("LastMessage.CreatedBy").
+		Where("rooms.id = ?", id).First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, messagerooms.ErrRoomNotFound
+	}
+
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &room, nil
+}
+
+func (r *roomRepository) Lookup(ctx context.Context, id string) (*messagerooms.Room, error) {
+	room := messagerooms.Room{}
+	err := r.db.WithContext(ctx).Where("rooms.id = ?", id).First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, messagerooms.ErrRoomNotFound
+	}
+
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &room, nil
+}
+
+// FindAll filters and sorts the rooms on their own table, so the indexes of the sorted fields are used, and only the
+// owners and last messages of the listed rooms are loaded. The rooms are paginated by their position in the order,
+// the rooms after the query's room are selected by comparing the sorted field first and then the id.
+func (r *roomRepository) FindAll(ctx context.Context, query messagerooms.RoomQuery) ([]*messagerooms.Room, error) {
+	tx := r.db.WithContext(ctx).Model(&messagerooms.Room{}).Preload("CreatedBy").Preload("LastMessage.CreatedBy")
+
+	if query.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(query.Search)) + "%"
+		tx = tx.Where("LOWER(rooms.room_name) LIKE ? ESCAPE '!'", pattern)
+	}
+
+	if query.MemberID != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM room_users WHERE room_users.room_id = rooms.id AND room_users.user_id = ?)", query.MemberID)
+	}
+
+	after := query.After
+	switch query.Sort {
+	case messagerooms.SortRoomsByActivity:
+		// the rooms without activity come last, in the order of their id.
+		if after != nil && after.LastActivityAt == nil {
+			tx = tx.Where("rooms.last_activity_at IS NULL AND rooms.id > ?", after.ID)
+		} else if after != nil {
+			tx = tx.Where(
+				"(rooms.last_activity_at < ? OR (rooms.last_activity_at = ? AND rooms.id > ?) OR rooms.last_activity_at IS NULL)",
+				*after.LastActivityAt, *after.LastActivityAt, after.ID,
+			)
+		}
+
+		tx = tx.Order("rooms.last_activity_at IS NULL").Order("rooms.last_activity_at DESC")
+	case messagerooms.SortRoomsByMembers:
+		if after != nil {
+			tx = tx.Where(
+				"(rooms.member_count < ? OR (rooms.member_count = ? AND rooms.id > ?))",
+				after.MemberCount, after.MemberCount, after.ID,
+			)
+		}
+
+		tx = tx.Order("rooms.member_count DESC")
+	default:
+		// the names are compared ignoring their case, whatever the collation of the database.
+		if after != nil {
+			tx = tx.Where(
+				"(LOWER(rooms.room_name) > LOWER(?) OR (LOWER(rooms.room_name) = LOWER(?) AND rooms.id > ?))",
+				after.RoomName, after.RoomName, after.ID,
+			)
+		}
+
+		tx = tx.Order("LOWER(rooms.room_name)")
+	}
+
+	if query.Limit > 0 {
+		tx = tx.Limit(query.Limit)
+	}
+
+	var rooms []*messagerooms.Room
+	if err := tx.Order("rooms.id").Find(&rooms).Error; err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return rooms, nil
+}
+
+// AddUserToRoom counts the new member of the room in the same transaction as the membership, or in a savepoint of
+// the unit of work it runs in.
+func (r *roomRepository) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) error {
+	alreadyExistsInRoom, err := r.CheckUserExistsInRoom(ctx, room, user)
+	if err != nil {
+		return err
+	}
+
+	if alreadyExistsInRoom {
+		return messagerooms.ErrUserAlreadyMember
+	}
+
+	err = r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&room).Association("Users").Append(&user); err != nil {
+			return err
+		}
+
+		return tx.Model(&messagerooms.Room{}).Where("id = ?", room.ID).
+			UpdateColumn("member_count", gorm.Expr("member_count + 1")).Error
+	})
+	if err != nil {
+		if r.isDuplicatedKey(err) {
+			return messagerooms.ErrUserAlreadyMember
+		}
+
+		return messagerooms.Unavailable(err)
+	}
+
+	return nil
+}
+
+// CheckUserExistsInRoom looks the membership up in the join table, the query is built by gorm so it is written in
+// the dialect of the database.
+func (r *roomRepository) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Table("room_users").Where("room_id = ? AND user_id = ?", room.ID, user.ID).Count(&count).Error
+	if err != nil {
+		return false, messagerooms.Unavailable(err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *roomRepository) RecordMessage(ctx context.Context, room messagerooms.Room, message messagerooms.Message) error {
+	result := r.db.WithContext(ctx).Model(&messagerooms.Room{}).Where("id = ?", room.ID).Updates(map[string]interface{}{
+		"message_count":    gorm.Expr("message_count + 1"),
+		"last_activity_at": message.CreatedAt,
+		"last_message_id":  message.ID,
+	})
+	if result.Error != nil {
+		return messagerooms.Unavailable(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return messagerooms.ErrRoomNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Package gormstore stores the users, rooms and messages in a SQL database through gorm. The queries are the same
+// whatever the database, what differs between them is described by a Dialect, provided by the packages of the
+// databases.
+package gormstore
+
+import (
+	"io/fs"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/migration"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Dialect describes a database the store runs on.
+type Dialect struct {
+	// System names the database system, like mysql or postgresql, the queries are traced with it.
+	System string
+
+	// IsDuplicatedKey reports whether a query failed on a unique key, the errors are specific to each driver.
+	IsDuplicatedKey func(err error) bool
+
+	// Migrations hold the schema of the database as versioned migrations, at the root of the file system.
+	Migrations fs.FS
+}
+
+// Store gives access to the repositories backed by a database.
+type Store struct {
+	db      *gorm.DB
+	dialect Dialect
+}
+
+// DB returns the database of the store.
+func (s *Store) DB() *gorm.DB {
+	return s.db
+}
+
+// System returns the name of the database system the store runs on.
+func (s *Store) System() string {
+	return s.dialect.System
+}
+
+// Users returns the repository of the users.
+func (s *Store) Users() messagerooms.UserRepository {
+	return &userRepository{db: s.db, isDuplicatedKey: s.dialect.IsDuplicatedKey}
+}
+
+// Rooms returns the repository of the rooms and their members.
+func (s *Store) Rooms() messagerooms.RoomRepository {
+	return &roomRepository{db: s.db, isDuplicatedKey: s.dialect.IsDuplicatedKey}
+}
+
+// Messages returns the repository of the messages.
+func (s *Store) Messages() messagerooms.MessageRepository {
+	return &messageRepository{db: s.db}
+}
+
+// UnitOfWork returns the UnitOfWork running its work in a transaction.
+func (s *Store) UnitOfWork() messagerooms.UnitOfWork {
+	return &unitOfWork{store: s}
+}
+
+// Migrator returns the Migrator bringing the schema of the database up to date with the repositories.
+func (s *Store) Migrator() (migration.Migrator, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	return migration.NewMigrator(sqlDB, s.dialect.Migrations)
+}
+
+// Close closes the connections to the database.
+func (s *Store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+// withDB returns the store running its queries on db, like a transaction of the store's database.
+func (s *Store) withDB(db *gorm.DB) *Store {
+	return &Store{db: db, dialect: s.dialect}
+}
+
+// Open opens the database of the dialector, and returns the store backed by it.
+func Open(dialector gorm.Dialector, dialect Dialect, config *gorm.Config) (*Store, error) {
+	db, err := gorm.Open(dialector, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening %s database", dialect.System)
+	}
+
+	return &Store{db: db, dialect: dialect}, nil
+}
@@ -0,0 +1,36 @@
+package gormstore
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+	"gorm.io/gorm"
+)
+
+type unitOfWork struct {
+	store *Store
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(repos messagerooms.Repositories) error) error {
+	var fnErr error
+	err := u.store.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		store := u.store.withDB(tx)
+		fnErr = fn(messagerooms.Repositories{
+			Users:    store.Users(),
+			Rooms:    store.Rooms(),
+			Messages: store.Messages(),
+		})
+		return fnErr
+	})
+
+	// the error of fn is returned as it is, the others are the transaction failing to begin or commit.
+	if fnErr != nil {
+		return fnErr
+	}
+
+	if err != nil {
+		return messagerooms.Unavailable(err)
+	}
+
+	return nil
+}
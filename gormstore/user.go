@@ -0,0 +1,86 @@
+package gormstore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+	"gorm.io/gorm"
+)
+
+type userRepository struct {
+	db              *gorm.DB
+	isDuplicatedKey func(err error) bool
+}
+
+func (u *userRepository) Create(ctx context.Context, nickname, password string) (*messagerooms.User, error) {
+	id := uuid.NewV4()
+	user := messagerooms.User{
+		ID:       id.String(),
+		Nickname: nickname,
+		Password: password,
+	}
+
+	if err := u.db.WithContext(ctx).Create(&user).Error; err != nil {
+		if u.isDuplicatedKey(err) {
+			return nil, messagerooms.ErrNicknameTaken
+		}
+
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &user, nil
+}
+
+func (u *userRepository) FindByID(ctx context.Context, id string) (*messagerooms.User, error) {
+	user := messagerooms.User{}
+
+	err := u.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, messagerooms.ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &user, nil
+}
+
+// Update checks the user exists when no row was changed, MySQL does not count the rows updated with the same values.
+func (u *userRepository) Update(ctx context.Context, user messagerooms.User) error {
+	result := u.db.WithContext(ctx).Model(&messagerooms.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"nickname": user.Nickname,
+		"password": user.Password,
+	})
+	if result.Error != nil {
+		if u.isDuplicatedKey(result.Error) {
+			return messagerooms.ErrNicknameTaken
+		}
+
+		return messagerooms.Unavailable(result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		_, err := u.FindByID(ctx, user.ID)
+		return err
+	}
+
+	return nil
+}
+
+func (u *userRepository) FindByNickname(ctx context.Context, nickname string) (*messagerooms.User, error) {
+	user := messagerooms.User{}
+
+	err := u.db.WithContext(ctx).Where("nickname = ?", nickname).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, messagerooms.ErrUserNotFound
+	}
+
+	if err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,85 @@
+// Package gormtracing traces the operations run through gorm with OpenTelemetry, whatever the database behind it.
+package gormtracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanInstanceKey is the instance setting holding the span of the running operation.
+const spanInstanceKey = "messagerooms:span"
+
+// Register registers gorm callbacks tracing every create, query, update, delete and raw query run through db and the
+// sessions derived from it. The spans are attributed to the database system, like mysql or postgresql. It must be
+// called before the repositories are created.
+func Register(db *gorm.DB, tracer trace.Tracer, system string) error {
+	callback := db.Callback()
+
+	return errors.Join(
+		callback.Create().Before("gorm:create").Register("messagerooms:trace_before_create", startSpan(tracer, system, "create")),
+		callback.Create().After("gorm:create").Register("messagerooms:trace_after_create", finishSpan),
+
+		callback.Query().Before("gorm:query").Register("messagerooms:trace_before_query", startSpan(tracer, system, "query")),
+		callback.Query().After("gorm:query").Register("messagerooms:trace_after_query", finishSpan),
+
+		callback.Update().Before("gorm:update").Register("messagerooms:trace_before_update", startSpan(tracer, system, "update")),
+		callback.Update().After("gorm:update").Register("messagerooms:trace_after_update", finishSpan),
+
+		callback.Delete().Before("gorm:delete").Register("messagerooms:trace_before_delete", startSpan(tracer, system, "delete")),
+		callback.Delete().After("gorm:delete").Register("messagerooms:trace_after_delete", finishSpan),
+
+		callback.Row().Before("gorm:row").Register("messagerooms:trace_before_row", startSpan(tracer, system, "row")),
+		callback.Row().After("gorm:row").Register("messagerooms:trace_after_row", finishSpan),
+
+		callback.Raw().Before("gorm:raw").Register("messagerooms:trace_before_raw", startSpan(tracer, system, "raw")),
+		callback.Raw().After("gorm:raw").Register("messagerooms:trace_after_raw", finishSpan),
+	)
+}
+
+// startSpan returns the callback starting the span of an operation, as a child of the span in the context the
+// operation is run with.
+func startSpan(tracer trace.Tracer, system, operation string) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx, span := tracer.Start(tx.Statement.Context, "gorm."+operation+" "+tx.Statement.Table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", system),
+				attribute.String("db.operation", operation),
+				attribute.String("db.sql.table", tx.Statement.Table),
+			),
+		)
+
+		tx.Statement.Context = ctx
+		tx.InstanceSet(spanInstanceKey, span)
+	}
+}
+
+// finishSpan ends the span of the operation with its statement and outcome. The values bound to the statement are
+// left out, they may contain user data.
+func finishSpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanInstanceKey)
+	if !ok {
+		return
+	}
+
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("db.statement", tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.RowsAffected),
+	)
+
+	// not finding a record is an expected outcome of the lookups, not a failure.
+	if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,49 @@
+// Package inmem keeps the users, rooms and messages in memory. Nothing survives a restart, it is meant for testing
+// the services without a database.
+package inmem
+
+import (
+	"sync"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// DB is the storage shared by the repositories, like a database connection is shared by the sql repositories.
+type DB struct {
+	mu       sync.RWMutex
+	users    map[string]messagerooms.User
+	rooms    map[string]messagerooms.Room
+	members  map[string][]string // members holds the ids of the room members keyed by room id, in the order they joined
+	messages []messagerooms.Message
+}
+
+// user returns the user with the id, the lock must be held.
+func (db *DB) user(id string) (*messagerooms.User, bool) {
+	user, ok := db.users[id]
+	if !ok {
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// message returns the message with the id along with its author, the lock must be held.
+func (db *DB) message(id string) (*messagerooms.Message, bool) {
+	for _, msg := range db.messages {
+		if msg.ID == id {
+			msg.CreatedBy, _ = db.user(msg.UserID)
+			return &msg, true
+		}
+	}
+
+	return nil, false
+}
+
+// NewDB returns an empty storage.
+func NewDB() *DB {
+	return &DB{
+		users:   make(map[string]messagerooms.User),
+		rooms:   make(map[string]messagerooms.Room),
+		members: make(map[string][]string),
+	}
+}
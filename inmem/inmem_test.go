@@ -0,0 +1,20 @@
+package inmem
+
+import (
+	"testing"
+
+	"github.com/iamsayantan/messagerooms/repositorytest"
+)
+
+func TestRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		db := NewDB()
+
+		return repositorytest.Repositories{
+			Users:      NewUserRepository(db),
+			Rooms:      NewRoomRepository(db),
+			Messages:   NewMessageRepository(db),
+			UnitOfWork: NewUnitOfWork(db),
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package inmem
+
+import (
+	"context"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+)
+
+type messageRepository struct {
+	db *DB
+	tx *transaction
+}
+
+func (m *messageRepository) PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	msg := messagerooms.Message{
+		ID:          uuid.NewV4().String(),
+		MessageText: messageText,
+		RoomID:      room.ID,
+		UserID:      user.ID,
+		CreatedAt:   time.Now(),
+	}
+
+	m.db.mu.Lock()
+	m.db.messages = append(m.db.messages, msg)
+	m.tx.onRollback(func() { m.removeMessage(msg.ID) })
+	msg.CreatedBy, _ = m.db.user(msg.UserID)
+	m.db.mu.Unlock()
+
+	return &msg, nil
+}
+
+func (m *messageRepository) GetMessage(ctx context.Context, messageID string) (*messagerooms.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	msg, ok := m.db.message(messageID)
+	if !ok {
+		return nil, messagerooms.ErrMessageNotFound
+	}
+
+	return msg, nil
+}
+
+// GetMessagesByRoom returns the messages of the room newest first. The messages are kept in the order they were
+// posted, so walking them backwards is enough.
+func (m *messageRepository) GetMessagesByRoom(ctx context.Context, room messagerooms.Room) ([]*messagerooms.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	m.db.mu.RLock()
+	defer m.db.mu.RUnlock()
+
+	var messages []*messagerooms.Message
+	for i := len(m.db.messages) - 1; i >= 0; i-- {
+		msg := m.db.messages[i]
+		if msg.RoomID != room.ID {
+			continue
+		}
+
+		msg.CreatedBy, _ = m.db.user(msg.UserID)
+		messages = append(messages, &msg)
+	}
+
+	return messages, nil
+}
+
+// removeMessage removes the message with the id, the lock must be held.
+func (m *messageRepository) removeMessage(messageID string) {
+	for i, msg := range m.db.messages {
+		if msg.ID == messageID {
+			m.db.messages = append(m.db.messages[:i], m.db.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// NewMessageRepository returns the in-memory implementation of MessageRepository interface.
+func NewMessageRepository(db *DB) messagerooms.MessageRepository {
+	return &messageRepository{db: db}
+}
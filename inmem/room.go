@@ -0,0 +1,269 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+)
+
+type roomRepository struct {
+	db *DB
+	tx *transaction
+}
+
+func (r *roomRepository) GetRoomMembers(ctx context.Context, room messagerooms.Room) ([]*messagerooms.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var users []*messagerooms.User
+	for _, userID := range r.db.members[room.ID] {
+		if user, ok := r.db.user(userID); ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// ListRoomMembers sorts the members by their nickname, they are kept in the order they joined.
+func (r *roomRepository) ListRoomMembers(ctx context.Context, room messagerooms.Room, after string, limit int) ([]*messagerooms.User, error) {
+	users, err := r.GetRoomMembers(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Nickname < users[j].Nickname
+	})
+
+	first := sort.Search(len(users), func(i int) bool {
+		return users[i].Nickname > after
+	})
+
+	users = users[first:]
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (r *roomRepository) Create(ctx context.Context, name string, user messagerooms.User) (*messagerooms.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	room := messagerooms.Room{
+		ID:       uuid.NewV4().String(),
+		RoomName: name,
+		UserID:   user.ID,
+	}
+
+	r.db.mu.Lock()
+	r.db.rooms[room.ID] = room
+	r.tx.onRollback(func() { delete(r.db.rooms, room.ID) })
+	r.db.mu.Unlock()
+
+	return &room, nil
+}
+
+func (r *roomRepository) Find(ctx context.Context, id string) (*messagerooms.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	room, ok := r.db.rooms[id]
+	if !ok {
+		return nil, messagerooms.ErrRoomNotFound
+	}
+
+	return r.load(room), nil
+}
+
+func (r *roomRepository) Lookup(ctx context.Context, id string) (*messagerooms.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	room, ok := r.db.rooms[id]
+	if !ok {
+		return nil, messagerooms.ErrRoomNotFound
+	}
+
+	room.MemberCount = len(r.db.members[room.ID])
+	return &room, nil
+}
+
+// FindAll sorts the rooms matching the query, the maps have no order of their own.
+func (r *roomRepository) FindAll(ctx context.Context, query messagerooms.RoomQuery) ([]*messagerooms.Room, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	search := strings.ToLower(query.Search)
+	rooms := make([]*messagerooms.Room, 0, len(r.db.rooms))
+	for _, room := range r.db.rooms {
+		if !strings.Contains(strings.ToLower(room.RoomName), search) {
+			continue
+		}
+
+		if query.MemberID != "" && !r.isMember(room.ID, query.MemberID) {
+			continue
+		}
+
+		loaded := r.load(room)
+		if query.After != nil && !roomBefore(query.Sort, query.After, loaded) {
+			continue
+		}
+
+		rooms = append(rooms, loaded)
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return roomBefore(query.Sort, rooms[i], rooms[j])
+	})
+
+	if query.Limit > 0 && len(rooms) > query.Limit {
+		rooms = rooms[:query.Limit]
+	}
+
+	return rooms, nil
+}
+
+func (r *roomRepository) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) error {
+	if err := ctx.Err(); err != nil {
+		return messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.isMember(room.ID, user.ID) {
+		return messagerooms.ErrUserAlreadyMember
+	}
+
+	r.db.members[room.ID] = append(r.db.members[room.ID], user.ID)
+	r.tx.onRollback(func() { r.removeMember(room.ID, user.ID) })
+	return nil
+}
+
+func (r *roomRepository) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	return r.isMember(room.ID, user.ID), nil
+}
+
+func (r *roomRepository) RecordMessage(ctx context.Context, room messagerooms.Room, message messagerooms.Message) error {
+	if err := ctx.Err(); err != nil {
+		return messagerooms.Unavailable(err)
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.rooms[room.ID]
+	if !ok {
+		return messagerooms.ErrRoomNotFound
+	}
+
+	lastActivityAt, lastMessageID := stored.LastActivityAt, stored.LastMessageID
+	stored.MessageCount++
+	stored.LastActivityAt = &message.CreatedAt
+	stored.LastMessageID = &message.ID
+	r.db.rooms[room.ID] = stored
+
+	r.tx.onRollback(func() {
+		stored := r.db.rooms[room.ID]
+		stored.MessageCount--
+		stored.LastActivityAt, stored.LastMessageID = lastActivityAt, lastMessageID
+		r.db.rooms[room.ID] = stored
+	})
+	return nil
+}
+
+// load returns the stored room with its owner, the number of its members and its last message, the lock must be held.
+func (r *roomRepository) load(room messagerooms.Room) *messagerooms.Room {
+	room.CreatedBy, _ = r.db.user(room.UserID)
+	room.MemberCount = len(r.db.members[room.ID])
+	if room.LastMessageID != nil {
+		room.LastMessage, _ = r.db.message(*room.LastMessageID)
+	}
+
+	return &room
+}
+
+// roomBefore reports whether the room a comes before b in the order, the rooms in the same position are ordered by
+// their id. The names are compared ignoring their case, like the databases do.
+func roomBefore(order messagerooms.RoomSort, a, b *messagerooms.Room) bool {
+	switch order {
+	case messagerooms.SortRoomsByActivity:
+		// the rooms without activity come last.
+		switch {
+		case a.LastActivityAt == nil && b.LastActivityAt != nil:
+			return false
+		case a.LastActivityAt != nil && b.LastActivityAt == nil:
+			return true
+		case a.LastActivityAt != nil && !a.LastActivityAt.Equal(*b.LastActivityAt):
+			return a.LastActivityAt.After(*b.LastActivityAt)
+		}
+	case messagerooms.SortRoomsByMembers:
+		if a.MemberCount != b.MemberCount {
+			return a.MemberCount > b.MemberCount
+		}
+	default:
+		if nameA, nameB := strings.ToLower(a.RoomName), strings.ToLower(b.RoomName); nameA != nameB {
+			return nameA < nameB
+		}
+	}
+
+	return a.ID < b.ID
+}
+
+// isMember reports whether the user joined the room, the lock must be held.
+func (r *roomRepository) isMember(roomID, userID string) bool {
+	for _, memberID := range r.db.members[roomID] {
+		if memberID == userID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeMember removes the user from the members of the room, the lock must be held.
+func (r *roomRepository) removeMember(roomID, userID string) {
+	members := r.db.members[roomID][:0]
+	for _, memberID := range r.db.members[roomID] {
+		if memberID != userID {
+			members = append(members, memberID)
+		}
+	}
+
+	r.db.members[roomID] = members
+}
+
+// NewRoomRepository returns the in-memory implementation of RoomRepository interface.
+func NewRoomRepository(db *DB) messagerooms.RoomRepository {
+	return &roomRepository{db: db}
+}
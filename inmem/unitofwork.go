@@ -0,0 +1,57 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// transaction records how to undo the changes made by the repositories of a unit of work. The changes are visible to
+// the other repositories before the unit of work ends, the units of work are atomic but not isolated.
+type transaction struct {
+	undo []func() // undo holds the functions reverting the changes, they are called with the lock held
+}
+
+// onRollback records how to undo a change, the lock must be held. The repositories outside a unit of work have no
+// transaction and record nothing.
+func (tx *transaction) onRollback(undo func()) {
+	if tx == nil {
+		return
+	}
+
+	tx.undo = append(tx.undo, undo)
+}
+
+type unitOfWork struct {
+	db *DB
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(repos messagerooms.Repositories) error) error {
+	if err := ctx.Err(); err != nil {
+		return messagerooms.Unavailable(err)
+	}
+
+	tx := &transaction{}
+	err := fn(messagerooms.Repositories{
+		Users:    &userRepository{db: u.db, tx: tx},
+		Rooms:    &roomRepository{db: u.db, tx: tx},
+		Messages: &messageRepository{db: u.db, tx: tx},
+	})
+	if err == nil {
+		return nil
+	}
+
+	// the changes are undone newest first, each of them may depend on the earlier ones.
+	u.db.mu.Lock()
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	u.db.mu.Unlock()
+
+	return err
+}
+
+// NewUnitOfWork returns the in-memory implementation of UnitOfWork interface.
+func NewUnitOfWork(db *DB) messagerooms.UnitOfWork {
+	return &unitOfWork{db: db}
+}
@@ -0,0 +1,103 @@
+package inmem
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+)
+
+type userRepository struct {
+	db *DB
+	tx *transaction
+}
+
+func (u *userRepository) Create(ctx context.Context, nickname, password string) (*messagerooms.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	user := messagerooms.User{
+		ID:       uuid.NewV4().String(),
+		Nickname: nickname,
+		Password: password,
+	}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	// the nicknames are unique like in the sql databases.
+	for _, existing := range u.db.users {
+		if existing.Nickname == nickname {
+			return nil, messagerooms.ErrNicknameTaken
+		}
+	}
+
+	u.db.users[user.ID] = user
+	u.tx.onRollback(func() { delete(u.db.users, user.ID) })
+
+	return &user, nil
+}
+
+func (u *userRepository) FindByID(ctx context.Context, id string) (*messagerooms.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	user, ok := u.db.user(id)
+	if !ok {
+		return nil, messagerooms.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func (u *userRepository) FindByNickname(ctx context.Context, nickname string) (*messagerooms.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, messagerooms.Unavailable(err)
+	}
+
+	u.db.mu.RLock()
+	defer u.db.mu.RUnlock()
+
+	for _, user := range u.db.users {
+		if user.Nickname == nickname {
+			return &user, nil
+		}
+	}
+
+	return nil, messagerooms.ErrUserNotFound
+}
+
+func (u *userRepository) Update(ctx context.Context, user messagerooms.User) error {
+	if err := ctx.Err(); err != nil {
+		return messagerooms.Unavailable(err)
+	}
+
+	u.db.mu.Lock()
+	defer u.db.mu.Unlock()
+
+	previous, ok := u.db.users[user.ID]
+	if !ok {
+		return messagerooms.ErrUserNotFound
+	}
+
+	for _, existing := range u.db.users {
+		if existing.ID != user.ID && existing.Nickname == user.Nickname {
+			return messagerooms.ErrNicknameTaken
+		}
+	}
+
+	u.db.users[user.ID] = user
+	u.tx.onRollback(func() { u.db.users[user.ID] = previous })
+
+	return nil
+}
+
+// NewUserRepository returns the in-memory implementation of UserRepository interface.
+func NewUserRepository(db *DB) messagerooms.UserRepository {
+	return &userRepository{db: db}
+}
@@ -1,6 +1,9 @@
 package messagerooms
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Message struct represents a single message
 type Message struct {
@@ -13,7 +16,11 @@ type Message struct {
 	RoomDetails *Room     `json:"room_details,omitempty" gorm:"foreignkey:RoomID"`
 }
 
-// NewMessageEvent is event struct that is sent to client on any new message.
+// newMessageEventVersion is the version of the NewMessageEvent payload.
+const newMessageEventVersion = 1
+
+// NewMessageEvent is event struct that is sent to client on any new message. It is published to the personal topic
+// of every member of the room, so the members get it whichever room they are viewing.
 type NewMessageEvent struct {
 	User    User    `json:"user"`
 	Room    Room    `json:"room"`
@@ -24,21 +31,22 @@ func (e *NewMessageEvent) GetTopic() string {
 	return TopicNewMessage + ":" + e.User.ID
 }
 
-func (e *NewMessageEvent) ToPublish(connID string) *PublishEvent {
-	return NewPublishEvent(connID, e.GetTopic(), e)
+func (e *NewMessageEvent) GetEvent() ServerEvent {
+	return NewMessageServerEvent
 }
 
-func (m Message) GetTopic() string {
-	return TopicNewMessage
+func (e *NewMessageEvent) GetVersion() int {
+	return newMessageEventVersion
 }
 
-func (m Message) ToPublish() *PublishEvent {
-	return NewPublishEvent("", m.GetTopic(), m)
+func (e *NewMessageEvent) ToPublish(connID string) *PublishEvent {
+	return NewPublishableEvent(connID, e)
 }
 
-// MessageRepository provides interface to access message storage.
+// MessageRepository provides interface to access message storage. The queries are cancelled along with the context.
+// The returned errors wrap ErrNotFound or ErrUnavailable.
 type MessageRepository interface {
-	PostMessage(room Room, user User, messageText string) (*Message, error)
-	GetMessage(messageID string) (*Message, error)
-	GetMessagesByRoom(room Room) ([]*Message, error)
+	PostMessage(ctx context.Context, room Room, user User, messageText string) (*Message, error)
+	GetMessage(ctx context.Context, messageID string) (*Message, error)
+	GetMessagesByRoom(ctx context.Context, room Room) ([]*Message, error)
 }
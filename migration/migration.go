@@ -0,0 +1,373 @@
+// Package migration applies versioned SQL migrations to a database. The migrations are plain SQL files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, the versions applied are recorded in the schema_migrations
+// table of the database.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSchemaBehind is returned by Check when the database misses some of the migrations.
+var ErrSchemaBehind = errors.New("database schema is behind, run the migrate command")
+
+// migrationFile matches the name of the migration files, capturing the version, the name and the direction.
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single schema change along with the script reverting it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies and reverts the migrations of a database.
+type Migrator interface {
+	// Up applies the migrations not applied yet in order of their version, and returns the ones applied.
+	Up(ctx context.Context) ([]Migration, error)
+
+	// Down reverts the given number of migrations, the most recent first, and returns the ones reverted.
+	Down(ctx context.Context, steps int) ([]Migration, error)
+
+	// Version returns the version of the last applied migration, zero if none is applied.
+	Version(ctx context.Context) (int64, error)
+
+	// Pending returns the migrations not applied yet.
+	Pending(ctx context.Context) ([]Migration, error)
+
+	// Check returns ErrSchemaBehind if any of the migrations is not applied.
+	Check(ctx context.Context) error
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func (m *migrator) Up(ctx context.Context) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range pending {
+		insert := fmt.Sprintf("INSERT INTO schema_migrations (version) VALUES (%d)", migration.Version)
+		if err := m.run(ctx, migration.Up, insert); err != nil {
+			return applied, errors.Wrapf(err, "applying migration %d_%s", migration.Version, migration.Name)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+func (m *migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	versions, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(versions) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration, ok := m.find(versions[i])
+		if !ok {
+			return reverted, errors.Errorf("migration %d is applied but unknown, it can not be reverted", versions[i])
+		}
+
+		remove := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %d", migration.Version)
+		if err := m.run(ctx, migration.Down, remove); err != nil {
+			return reverted, errors.Wrapf(err, "reverting migration %d_%s", migration.Version, migration.Name)
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+func (m *migrator) Version(ctx context.Context) (int64, error) {
+	versions, err := m.appliedVersions(ctx)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+func (m *migrator) Pending(ctx context.Context) ([]Migration, error) {
+	versions, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]struct{}, len(versions))
+	for _, version := range versions {
+		applied[version] = struct{}{}
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *migrator) Check(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return errors.Wrapf(ErrSchemaBehind, "%d migrations pending", len(pending))
+	}
+
+	return nil
+}
+
+// run executes the statements of a script followed by the bookkeeping statement in a transaction. Databases that
+// commit schema changes implicitly, like MySQL, still record the version only once the script succeeded.
+func (m *migrator) run(ctx context.Context, script, bookkeeping string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range append(splitStatements(script), bookkeeping) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *migrator) createVersionTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY)")
+	return errors.Wrap(err, "creating schema_migrations table")
+}
+
+// appliedVersions returns the applied versions in ascending order. The version table is created on first use.
+func (m *migrator) appliedVersions(ctx context.Context) ([]int64, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching applied migrations")
+	}
+	defer rows.Close()
+
+	var versions []int64
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, errors.Wrap(err, "fetching applied migrations")
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, errors.Wrap(rows.Err(), "fetching applied migrations")
+}
+
+func (m *migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+// dollarQuote matches the opening tag of a PostgreSQL dollar quoted string, like $$ or $body$.
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// splitStatements splits a script on the semicolons ending its statements. Semicolons inside string literals, quoted
+// identifiers, comments and dollar quoted strings do not end a statement, nor do the ones inside BEGIN ... END blocks,
+// like the body of a trigger or a procedure. Quotes are escaped by doubling them. The scripts run in a transaction, so
+// they must not start one with BEGIN themselves.
+func splitStatements(script string) []string {
+	var (
+		statements []string
+		start      int    // start of the current statement
+		depth      int    // depth of the BEGIN ... END blocks and CASE expressions around the scanned text
+		lastWord   string // lastWord is the previous word of the statement, END IF and END CASE close a single block
+		endClosed  bool   // endClosed is set when the last END closed a block
+	)
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(script, i)
+		case strings.HasPrefix(script[i:], "--"):
+			i = skipPast(script, i, "\n")
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipPast(script, i+2, "*/")
+		case c == '$':
+			i = skipDollarQuoted(script, i)
+		case isWordStart(c):
+			j := i + 1
+			for j < len(script) && (isWordStart(script[j]) || script[j] == '$') {
+				j++
+			}
+
+			word := strings.ToUpper(script[i:j])
+			switch {
+			case lastWord == "END" && endClosed && (word == "IF" || word == "LOOP" || word == "WHILE" || word == "REPEAT"):
+				// the END closed a block that was not counted, not the enclosing one.
+				depth++
+			case word == "BEGIN", word == "CASE" && lastWord != "END":
+				depth++
+			case word == "END":
+				if endClosed = depth > 0; endClosed {
+					depth--
+				}
+			}
+
+			lastWord = word
+			i = j
+		case c == ';' && depth == 0:
+			if statement := strings.TrimSpace(script[start:i]); statement != "" {
+				statements = append(statements, statement)
+			}
+
+			i++
+			start, lastWord = i, ""
+		default:
+			i++
+		}
+	}
+
+	if statement := strings.TrimSpace(script[start:]); statement != "" {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// skipQuoted returns the position after the quoted text starting at i, a doubled quote is part of the text.
+func skipQuoted(script string, i int) int {
+	quote := script[i]
+	for j := i + 1; j < len(script); j++ {
+		if script[j] != quote {
+			continue
+		}
+
+		if j+1 < len(script) && script[j+1] == quote {
+			j++
+			continue
+		}
+
+		return j + 1
+	}
+
+	return len(script)
+}
+
+// skipPast returns the position after the first marker found from i, or the end of the script.
+func skipPast(script string, i int, marker string) int {
+	if end := strings.Index(script[i:], marker); end >= 0 {
+		return i + end + len(marker)
+	}
+
+	return len(script)
+}
+
+// skipDollarQuoted returns the position after the dollar quoted string starting at i. A dollar sign that does not
+// open one, like a positional parameter, is skipped alone.
+func skipDollarQuoted(script string, i int) int {
+	tag := dollarQuote.FindString(script[i:])
+	if tag == "" {
+		return i + 1
+	}
+
+	return skipPast(script, i+len(tag), tag)
+}
+
+// Load reads the migrations from the root of fsys. Every migration must come with both its up and down script.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "reading migrations")
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing version of %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", entry.Name())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, errors.Errorf("migrations %s and %s share version %d", migration.Name, match[2], version)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, errors.Errorf("migration %d_%s needs both an up and a down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// NewMigrator returns a Migrator applying the migrations found at the root of fsys to the database.
+func NewMigrator(db *sql.DB, fsys fs.FS) (Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{db: db, migrations: migrations}, nil
+}
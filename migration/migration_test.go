@@ -0,0 +1,307 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/glebarez/sqlite" // registers the sqlite driver
+	"github.com/pkg/errors"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "statements",
+			script: "CREATE TABLE a (id INT);\n\nCREATE INDEX idx_a ON a (id);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE INDEX idx_a ON a (id)"},
+		},
+		{
+			name:   "without a trailing semicolon",
+			script: "DROP TABLE a;\nDROP TABLE b",
+			want:   []string{"DROP TABLE a", "DROP TABLE b"},
+		},
+		{
+			name:   "semicolons in literals",
+			script: "INSERT INTO a VALUES ('x;y', 'it''s; fine');\nALTER TABLE \"a;b\" ADD COLUMN `c;d` INT;",
+			want:   []string{"INSERT INTO a VALUES ('x;y', 'it''s; fine')", "ALTER TABLE \"a;b\" ADD COLUMN `c;d` INT"},
+		},
+		{
+			name:   "semicolons in comments",
+			script: "-- drop it; really\nDROP TABLE a; /* and b; too */ DROP TABLE b;",
+			want:   []string{"-- drop it; really\nDROP TABLE a", "/* and b; too */ DROP TABLE b"},
+		},
+		{
+			name: "dollar quoted function",
+			script: "CREATE FUNCTION touch() RETURNS trigger AS $body$ BEGIN NEW.updated_at = now(); RETURN NEW; END; $body$ LANGUAGE plpgsql;\n" +
+				"SELECT $$a;b$$, $1;",
+			want: []string{
+				"CREATE FUNCTION touch() RETURNS trigger AS $body$ BEGIN NEW.updated_at = now(); RETURN NEW; END; $body$ LANGUAGE plpgsql",
+				"SELECT $$a;b$$, $1",
+			},
+		},
+		{
+			name: "trigger",
+			script: "CREATE TRIGGER count_messages AFTER INSERT ON messages BEGIN\n" +
+				"  UPDATE rooms SET message_count = message_count + CASE WHEN NEW.id IS NULL THEN 0 ELSE 1 END WHERE id = NEW.room_id;\n" +
+				"END;\nDROP TABLE a;",
+			want: []string{
+				"CREATE TRIGGER count_messages AFTER INSERT ON messages BEGIN\n" +
+					"  UPDATE rooms SET message_count = message_count + CASE WHEN NEW.id IS NULL THEN 0 ELSE 1 END WHERE id = NEW.room_id;\nEND",
+				"DROP TABLE a",
+			},
+		},
+		{
+			name: "procedure",
+			script: "CREATE PROCEDURE prune() BEGIN\n  IF (SELECT COUNT(*) FROM a) > 10 THEN DELETE FROM a; END IF;\n" +
+				"  CASE WHEN 1 THEN SELECT 1; END CASE;\nEND;\nCREATE TABLE IF NOT EXISTS b (id INT);",
+			want: []string{
+				"CREATE PROCEDURE prune() BEGIN\n  IF (SELECT COUNT(*) FROM a) > 10 THEN DELETE FROM a; END IF;\n" +
+					"  CASE WHEN 1 THEN SELECT 1; END CASE;\nEND",
+				"CREATE TABLE IF NOT EXISTS b (id INT)",
+			},
+		},
+		{
+			name:   "empty statements",
+			script: " ;\n;DROP TABLE a;; \n",
+			want:   []string{"DROP TABLE a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0002_add_index.up.sql":      {Data: []byte("CREATE INDEX idx ON a (id);")},
+		"0002_add_index.down.sql":    {Data: []byte("DROP INDEX idx;")},
+		"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"0001_create_table.down.sql": {Data: []byte("DROP TABLE a;")},
+		"README.md":                  {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "create_table", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX idx ON a (id);", Down: "DROP INDEX idx;"},
+	}
+	if !reflect.DeepEqual(migrations, want) {
+		t.Errorf("Load() = %+v, want %+v", migrations, want)
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing down script": {
+			"0001_create_table.up.sql": {Data: []byte("CREATE TABLE a (id INT);")},
+		},
+		"shared version": {
+			"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+			"0001_create_table.down.sql": {Data: []byte("DROP TABLE a;")},
+			"0001_other_table.up.sql":    {Data: []byte("CREATE TABLE b (id INT);")},
+			"0001_other_table.down.sql":  {Data: []byte("DROP TABLE b;")},
+		},
+	}
+
+	for name, fsys := range invalid {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("Load() with %s succeeded", name)
+		}
+	}
+}
+
+// scripts are the migrations applied to the test database. The trigger checks that statements with semicolons in
+// their body are applied whole.
+var scripts = fstest.MapFS{
+	"0001_create_rooms.up.sql": {Data: []byte(`
+CREATE TABLE rooms (id VARCHAR(255) NOT NULL PRIMARY KEY, room_name VARCHAR(255) DEFAULT 'general; chat');
+CREATE TABLE messages (id VARCHAR(255) NOT NULL PRIMARY KEY, room_id VARCHAR(255));`)},
+	"0001_create_rooms.down.sql": {Data: []byte("DROP TABLE messages;\nDROP TABLE rooms;")},
+	"0002_count_messages.up.sql": {Data: []byte(`
+ALTER TABLE rooms ADD COLUMN message_count INTEGER NOT NULL DEFAULT 0;
+CREATE TRIGGER count_messages AFTER INSERT ON messages BEGIN
+    UPDATE rooms SET message_count = message_count + 1 WHERE id = NEW.room_id;
+END;`)},
+	"0002_count_messages.down.sql": {Data: []byte("DROP TRIGGER count_messages;\nALTER TABLE rooms DROP COLUMN message_count;")},
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migration.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, fsys fstest.MapFS) Migrator {
+	t.Helper()
+
+	m, err := NewMigrator(db, fsys)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+
+	return m
+}
+
+func versions(migrations []Migration) []int64 {
+	var versions []int64
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+
+	return versions
+}
+
+func expectVersion(t *testing.T, m Migrator, want int64) {
+	t.Helper()
+
+	version, err := m.Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version() error = %v", err)
+	}
+
+	if version != want {
+		t.Errorf("Version() = %d, want %d", version, want)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	m := newTestMigrator(t, db, scripts)
+
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("Check() before migrating error = %v, want %v", err, ErrSchemaBehind)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Up() applied %v, want [1 2]", got)
+	}
+
+	expectVersion(t, m, 2)
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("Check() after migrating error = %v", err)
+	}
+
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("Up() again = %v, %v, want nothing applied", versions(applied), err)
+	}
+
+	// the trigger was created whole and counts the messages.
+	if _, err := db.ExecContext(ctx, "INSERT INTO rooms (id) VALUES ('room-1')"); err != nil {
+		t.Fatalf("inserting room: %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, "INSERT INTO messages (id, room_id) VALUES ('message-1', 'room-1')"); err != nil {
+		t.Fatalf("inserting message: %v", err)
+	}
+
+	var name string
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT room_name, message_count FROM rooms WHERE id = 'room-1'").Scan(&name, &count); err != nil {
+		t.Fatalf("fetching room: %v", err)
+	}
+
+	if name != "general; chat" || count != 1 {
+		t.Errorf("room = %q with %d messages, want %q with 1 message", name, count, "general; chat")
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+
+	if got := versions(reverted); !reflect.DeepEqual(got, []int64{2}) {
+		t.Errorf("Down() reverted %v, want [2]", got)
+	}
+
+	expectVersion(t, m, 1)
+	if err := m.Check(ctx); !errors.Is(err, ErrSchemaBehind) {
+		t.Errorf("Check() after reverting error = %v, want %v", err, ErrSchemaBehind)
+	}
+
+	if reverted, err := m.Down(ctx, 5); err != nil || !reflect.DeepEqual(versions(reverted), []int64{1}) {
+		t.Errorf("Down() past the first migration = %v, %v, want [1] reverted", versions(reverted), err)
+	}
+
+	expectVersion(t, m, 0)
+}
+
+func TestMigrateUpFailure(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	failing := fstest.MapFS{
+		"0003_broken.up.sql":   {Data: []byte("CREATE TABLE broken (id INT);\nINSERT INTO missing VALUES (1);")},
+		"0003_broken.down.sql": {Data: []byte("DROP TABLE broken;")},
+	}
+	for name, file := range scripts {
+		failing[name] = file
+	}
+
+	m := newTestMigrator(t, db, failing)
+	applied, err := m.Up(ctx)
+	if err == nil {
+		t.Fatal("Up() with a broken migration succeeded")
+	}
+
+	if got := versions(applied); !reflect.DeepEqual(got, []int64{1, 2}) {
+		t.Errorf("Up() applied %v before failing, want [1 2]", got)
+	}
+
+	expectVersion(t, m, 2)
+
+	// the broken migration is rolled back as a whole.
+	var tables int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'broken'").Scan(&tables); err != nil {
+		t.Fatalf("looking up table: %v", err)
+	}
+
+	if tables != 0 {
+		t.Error("table of the broken migration was kept")
+	}
+}
+
+func TestMigrateDownUnknownVersion(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+
+	if _, err := newTestMigrator(t, db, scripts).Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// a migrator of an older release does not know the latest migration.
+	older := fstest.MapFS{}
+	for name, file := range scripts {
+		if name[:4] == "0001" {
+			older[name] = file
+		}
+	}
+
+	if _, err := newTestMigrator(t, db, older).Down(ctx, 1); err == nil {
+		t.Error("Down() of an unknown migration succeeded")
+	}
+}
@@ -0,0 +1,30 @@
+-- The tables as they were created by gorm's AutoMigrate, so the databases created before the migrations are picked
+-- up as they are.
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(255) NOT NULL,
+    password VARCHAR(255),
+    nickname VARCHAR(255),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id VARCHAR(255) NOT NULL,
+    room_name VARCHAR(255),
+    user_id VARCHAR(255),
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS room_users (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255),
+    room_id VARCHAR(255),
+    message_text VARCHAR(255),
+    created_at DATETIME NULL,
+    PRIMARY KEY (id)
+);
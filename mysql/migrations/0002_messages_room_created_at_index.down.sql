@@ -0,0 +1 @@
+DROP INDEX idx_messages_room_id_created_at ON messages;
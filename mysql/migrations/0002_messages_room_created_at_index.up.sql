@@ -0,0 +1,2 @@
+-- The messages of a room are always fetched in the order they were posted.
+CREATE INDEX idx_messages_room_id_created_at ON messages (room_id, created_at);
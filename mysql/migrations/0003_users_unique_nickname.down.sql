@@ -0,0 +1 @@
+DROP INDEX uix_users_nickname ON users;
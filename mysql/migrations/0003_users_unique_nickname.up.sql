@@ -0,0 +1,3 @@
+-- Users are looked up by their nickname on login, it must identify a single user. Duplicated nicknames have to be
+-- resolved by hand before this migration can be applied.
+CREATE UNIQUE INDEX uix_users_nickname ON users (nickname);
@@ -0,0 +1,3 @@
+DROP INDEX idx_rooms_last_activity_at ON rooms;
+DROP INDEX idx_rooms_room_name ON rooms;
+ALTER TABLE rooms DROP COLUMN last_message_id;
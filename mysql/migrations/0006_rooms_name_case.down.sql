@@ -0,0 +1,2 @@
+DROP INDEX idx_rooms_lower_room_name ON rooms;
+CREATE INDEX idx_rooms_room_name ON rooms (room_name);
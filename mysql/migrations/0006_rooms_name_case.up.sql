@@ -0,0 +1,3 @@
+-- The rooms are listed by their name ignoring its case, functional indexes need MySQL 8.0.13 or later.
+DROP INDEX idx_rooms_room_name ON rooms;
+CREATE INDEX idx_rooms_lower_room_name ON rooms ((LOWER(room_name)));
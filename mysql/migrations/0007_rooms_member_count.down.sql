@@ -0,0 +1,2 @@
+DROP INDEX idx_rooms_member_count ON rooms;
+ALTER TABLE rooms DROP COLUMN member_count;
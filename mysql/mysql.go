@@ -0,0 +1,34 @@
+// Package mysql runs the store on MySQL.
+package mysql
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+
+	"github.com/iamsayantan/messagerooms/gormstore"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// migrations holds the schema of the MySQL database as versioned migrations.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open connects to the MySQL database of the DSN. The DSN needs parseTime=True for the message times.
+func Open(dsn string, config *gorm.Config) (*gormstore.Store, error) {
+	scripts, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	dialect := gormstore.Dialect{System: "mysql", IsDuplicatedKey: isDuplicatedKey, Migrations: scripts}
+	return gormstore.Open(gormmysql.Open(dsn), dialect, config)
+}
+
+// isDuplicatedKey reports whether the query failed on a unique key, whether or not the database was opened with
+// TranslateError.
+func isDuplicatedKey(err error) bool {
+	return errors.Is(gormmysql.Dialector{}.Translate(err), gorm.ErrDuplicatedKey)
+}
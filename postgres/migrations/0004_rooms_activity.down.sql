@@ -0,0 +1,2 @@
+-- The owners who joined their rooms in the up migration stay members, they can not be told apart from the others.
+ALTER TABLE rooms DROP COLUMN IF EXISTS last_activity_at, DROP COLUMN IF EXISTS message_count;
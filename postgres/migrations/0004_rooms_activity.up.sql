@@ -0,0 +1,14 @@
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS message_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_activity_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- Posting a message updates the activity of its room, the rooms of the existing messages are brought up to date.
+UPDATE rooms SET
+    message_count = (SELECT COUNT(*) FROM messages WHERE messages.room_id = rooms.id),
+    last_activity_at = (SELECT MAX(messages.created_at) FROM messages WHERE messages.room_id = rooms.id);
+
+-- The owner of a room is its first member, the owners of the existing rooms join them.
+INSERT INTO room_users (room_id, user_id)
+SELECT rooms.id, rooms.user_id FROM rooms
+WHERE rooms.user_id IS NOT NULL AND rooms.user_id <> '' AND NOT EXISTS (
+    SELECT 1 FROM room_users WHERE room_users.room_id = rooms.id AND room_users.user_id = rooms.user_id
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_rooms_last_activity_at;
+DROP INDEX IF EXISTS idx_rooms_room_name;
+ALTER TABLE rooms DROP COLUMN IF EXISTS last_message_id;
@@ -0,0 +1,3 @@
+-- The rooms are listed by their name ignoring its case.
+DROP INDEX IF EXISTS idx_rooms_room_name;
+CREATE INDEX IF NOT EXISTS idx_rooms_lower_room_name ON rooms (LOWER(room_name));
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rooms_member_count;
+ALTER TABLE rooms DROP COLUMN IF EXISTS member_count;
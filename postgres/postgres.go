@@ -0,0 +1,34 @@
+// Package postgres runs the store on PostgreSQL.
+package postgres
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+
+	"github.com/iamsayantan/messagerooms/gormstore"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// migrations holds the schema of the PostgreSQL database as versioned migrations.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open connects to the PostgreSQL database of the DSN.
+func Open(dsn string, config *gorm.Config) (*gormstore.Store, error) {
+	scripts, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	dialect := gormstore.Dialect{System: "postgresql", IsDuplicatedKey: isDuplicatedKey, Migrations: scripts}
+	return gormstore.Open(gormpostgres.Open(dsn), dialect, config)
+}
+
+// isDuplicatedKey reports whether the query failed on a unique key, whether or not the database was opened with
+// TranslateError.
+func isDuplicatedKey(err error) bool {
+	return errors.Is(gormpostgres.Dialector{}.Translate(err), gorm.ErrDuplicatedKey)
+}
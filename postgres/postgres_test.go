@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/iamsayantan/messagerooms/gormstore"
+	"github.com/iamsayantan/messagerooms/repositorytest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestStore connects to the database named by POSTGRES_TEST_DSN and migrates it, the test is skipped if it is not
+// set.
+func openTestStore(t *testing.T) *gormstore.Store {
+	t.Helper()
+
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	store, err := Open(dsn, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connecting to postgres: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	migrator, err := store.Migrator()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating database: %v", err)
+	}
+
+	return store
+}
+
+func TestRepositories(t *testing.T) {
+	store := openTestStore(t)
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return repositorytest.Repositories{
+			Users:      store.Users(),
+			Rooms:      store.Rooms(),
+			Messages:   store.Messages(),
+			UnitOfWork: store.UnitOfWork(),
+		}
+	})
+}
@@ -3,8 +3,9 @@ package messagerooms
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"sync"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -18,14 +19,30 @@ type ServerEvent string
 const HubChannel = "HubChannel"
 
 const (
-	TopicNewMessage = "NewMessage"
-	TopicNewRoom    = "NewRoom"
+	TopicNewMessage   = "NewMessage"
+	TopicNewRoom      = "NewRoom"
+	TopicRoomActivity = "RoomActivity"
+
+	// TopicConnectionControl carries the commands for a single connection, like terminating it from another node.
+	TopicConnectionControl = "ConnectionControl"
 )
 
 var (
 	ConnectionEvent  ServerEvent = "ClientConnection"
 	HeartbeatEvent   ServerEvent = "Heartbeat"
-	MessageRoomEvent ServerEvent = "MessageEvent"
+	ReconnectEvent   ServerEvent = "Reconnect"
+	TerminatedEvent  ServerEvent = "Terminated"
+	MessageRoomEvent ServerEvent = "MessageEvent" // MessageRoomEvent is sent for published events not declaring their own event
+)
+
+// Events of the publishables, the clients can listen to each of them separately.
+var (
+	NewMessageServerEvent        ServerEvent = "new_message"
+	RoomCreatedServerEvent       ServerEvent = "room_created"
+	MembershipChangedServerEvent ServerEvent = "membership_changed"
+
+	// TerminateConnectionServerEvent is handled by the hub owning the connection and never reaches the client.
+	TerminateConnectionServerEvent ServerEvent = "terminate_connection"
 )
 
 // Publishable is the interface that all types must implement that wish to be published into the pubsub system.
@@ -33,42 +50,272 @@ type Publishable interface {
 	// GetTopic returns an topic identifier for a publishable model
 	GetTopic() string
 
+	// GetEvent returns the SSE event the publishable is delivered to the clients as.
+	GetEvent() ServerEvent
+
+	// GetVersion returns the version of the payload schema. It must be bumped on any change to the payload that
+	// existing clients can not handle.
+	GetVersion() int
+
 	// ToPublish() method returns an PublishEvent that can be then pushed into the redis pubsub to be broadcast.
 	ToPublish(connID string) *PublishEvent
 }
 
-// EventsourceConnection represents a single persistent connection.
+// OverflowPolicy decides what happens when an event is published to a connection whose send buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest drops the oldest queued event to make room for the new one.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+
+	// OverflowDisconnect disconnects the connection, the client is expected to reconnect and catch up.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+
+	// OverflowCoalesce replaces a queued event having the same coalesce key with the new one. If there is no such
+	// event, the oldest queued event is dropped.
+	OverflowCoalesce OverflowPolicy = "coalesce"
+)
+
+var (
+	// ErrEventDropped is returned when an event was dropped because the connection's send buffer is full.
+	ErrEventDropped = errors.New("event dropped, send buffer is full")
+
+	// ErrEventCoalesced is returned when a queued event was replaced by the published one.
+	ErrEventCoalesced = errors.New("event coalesced with a queued event")
+
+	// ErrConnectionOverflow is returned when the connection is disconnected because its send buffer is full.
+	ErrConnectionOverflow = errors.New("send buffer overflowed, connection is disconnected")
+
+	// ErrServerShutdown is the reason a connection is disconnected when the server shuts down.
+	ErrServerShutdown = errors.New("server is shutting down")
+
+	// ErrUserConnectionLimit is the reason a connection is rejected when the user has too many connections open.
+	ErrUserConnectionLimit = errors.New("too many connections open for the user")
+
+	// ErrNodeConnectionLimit is the reason a connection is rejected when the server has too many connections open.
+	ErrNodeConnectionLimit = errors.New("too many connections open on the server")
+
+	// ErrConnectionTerminated is the reason a connection is disconnected when the user terminates it.
+	ErrConnectionTerminated = errors.New("connection terminated by the user")
+
+	// ErrInvalidOverflowPolicy is returned when parsing an unknown overflow policy.
+	ErrInvalidOverflowPolicy = errors.New("invalid overflow policy")
+)
+
+// ParseOverflowPolicy returns the OverflowPolicy with the given name.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case OverflowDropOldest, OverflowDisconnect, OverflowCoalesce:
+		return policy, nil
+	default:
+		return "", ErrInvalidOverflowPolicy
+	}
+}
+
+// EventsourceConnection represents a single persistent connection. Events published to the connection are queued
+// in a bounded send buffer, so a slow client never blocks the publisher.
 type EventsourceConnection struct {
-	ConnectionID string            // ConnectionID is an unique connection id for the connection
-	User         *User             // User for whom the connection is opened
-	SendCh       chan EventMessage // SendCh channel is used to send messages to the particular connection
+	ConnectionID string    // ConnectionID is an unique connection id for the connection
+	User         *User     // User for whom the connection is opened
+	UserAgent    string    // UserAgent of the client that opened the connection
+	ConnectedAt  time.Time // ConnectedAt is when the connection was opened
+
+	bufferSize     int            // bufferSize is the maximum number of queued events
+	overflowPolicy OverflowPolicy // overflowPolicy decides what happens when the send buffer is full
 
-	ticker  *time.Ticker // ticker is used for sending heartbeats to the client
-	closing chan bool    // closing channel receives data if the client closes
+	mu            sync.Mutex
+	subscriptions map[string]struct{} // subscriptions holds the topics the client subscribed the connection to
+	queue         []EventMessage      // queue holds the events waiting to be sent to the client
+	sequence      int64               // sequence of the last queued event
+	ready         chan struct{}       // ready receives a value whenever events are queued
+	done          chan struct{}       // done is closed when the server disconnects the connection
+	doneErr       error               // doneErr is the reason the connection was disconnected
+	ticker        *time.Ticker        // ticker is used for sending heartbeats to the client
+	closing       chan struct{}       // closing channel is closed when the client closes
+	closingOnce   sync.Once
 }
 
 // PublishEvent is the container for publishing events.
 type PublishEvent struct {
 	ConnectionID string      `json:"connection_id"` // ConnectionID is used for sending the event to the open connection
 	Topic        string      `json:"topic"`         // Topic of the event.
-	CreatedAt    int64       `json:"created_at"`    // CreatedAt when the event was created. Can be used to track how much time it takes form creation to delivery.
+	Event        ServerEvent `json:"event"`         // Event is the SSE event the payload is delivered as.
+	Version      int         `json:"version"`       // Version of the payload schema.
+	CreatedAt    int64       `json:"created_at"`    // CreatedAt when the event was created in unix nanoseconds, the hub tracks the publish latency with it.
 	Payload      interface{} `json:"payload"`       // Payload actual payload for the event.
+	RequestID    string      `json:"request_id"`    // RequestID of the request the event was published for, if any.
+
+	// TraceContext carries the trace of the publishing request across the pubsub system, so the delivery of the
+	// event shows up in the same trace.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// PublishEvent queues an event in the connection's send buffer, it never blocks. If the buffer is full the overflow
+// policy is applied, and the returned error tells what happened to make room for the event.
+func (ec *EventsourceConnection) PublishEvent(evt EventMessage) error {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	if ec.doneErr != nil {
+		return ec.doneErr
+	}
+
+	var err error
+	if len(ec.queue) >= ec.bufferSize {
+		switch ec.overflowPolicy {
+		case OverflowDisconnect:
+			ec.queue = nil
+			ec.disconnect(ErrConnectionOverflow)
+			return ErrConnectionOverflow
+		case OverflowCoalesce:
+			if evt.CoalesceKey != "" {
+				for i := range ec.queue {
+					if ec.queue[i].CoalesceKey == evt.CoalesceKey {
+						// the event takes the place of the queued one, keeping the sequence in order.
+						evt.Sequence = ec.queue[i].Sequence
+						ec.queue[i] = evt
+						return ErrEventCoalesced
+					}
+				}
+			}
+			fallthrough
+		default:
+			ec.queue = ec.queue[1:]
+			err = ErrEventDropped
+		}
+	}
+
+	ec.sequence++
+	evt.Sequence = ec.sequence
+	ec.queue = append(ec.queue, evt)
+
+	// ready is buffered by one, if a value is already pending the consumer has not drained the queue yet
+	// and will pick up this event as well.
+	select {
+	case ec.ready <- struct{}{}:
+	default:
+	}
+
+	return err
+}
+
+// Ready returns a channel that receives a value whenever there are events queued for the connection.
+func (ec *EventsourceConnection) Ready() <-chan struct{} {
+	return ec.ready
+}
+
+// Disconnect tells the handler of the connection to close it after sending the events that are already queued.
+// The reason is returned by Err, and by PublishEvent for any event published afterwards.
+func (ec *EventsourceConnection) Disconnect(reason error) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	ec.disconnect(reason)
+}
+
+func (ec *EventsourceConnection) disconnect(reason error) {
+	if ec.doneErr != nil {
+		return
+	}
+
+	ec.doneErr = reason
+	close(ec.done)
+}
+
+// Done returns a channel that is closed when the server disconnects the connection, either because its send buffer
+// overflowed or the server is shutting down.
+func (ec *EventsourceConnection) Done() <-chan struct{} {
+	return ec.done
+}
+
+// Err returns the reason the connection was disconnected, nil if it is not disconnected.
+func (ec *EventsourceConnection) Err() error {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	return ec.doneErr
+}
+
+// Drain removes and returns all the queued events.
+func (ec *EventsourceConnection) Drain() []EventMessage {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	events := ec.queue
+	ec.queue = nil
+	return events
+}
+
+// QueueDepth returns the number of events waiting to be sent.
+func (ec *EventsourceConnection) QueueDepth() int {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	return len(ec.queue)
+}
+
+// AddSubscriptions records topics the client subscribed the connection to, on top of the personal topics.
+func (ec *EventsourceConnection) AddSubscriptions(topics ...string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	for _, topic := range topics {
+		ec.subscriptions[topic] = struct{}{}
+	}
+}
+
+// RemoveSubscriptions forgets topics the client unsubscribed the connection from.
+func (ec *EventsourceConnection) RemoveSubscriptions(topics ...string) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(ec.subscriptions, topic)
+	}
+}
+
+// Subscriptions returns the topics the client subscribed the connection to.
+func (ec *EventsourceConnection) Subscriptions() []string {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	topics := make([]string, 0, len(ec.subscriptions))
+	for topic := range ec.subscriptions {
+		topics = append(topics, topic)
+	}
+	return topics
 }
 
-// PublishEvent publishes an event to connection's SendChannel
-func (ec *EventsourceConnection) PublishEvent(evt EventMessage) {
-	log.Printf("Publishing event: %s, Destination: %s", evt.Event, evt.DestinationID)
-	ec.SendCh <- evt
+// ControlTopic returns the topic the commands for the connection are published to.
+func (ec *EventsourceConnection) ControlTopic() string {
+	return TopicConnectionControl + ":" + ec.ConnectionID
 }
 
-// Closing is for housekeeping works.
+// IsClosing reports whether the connection is closed and being cleaned up.
+func (ec *EventsourceConnection) IsClosing() bool {
+	select {
+	case <-ec.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Closed returns a channel that is closed once the connection is closed and is being cleaned up.
+func (ec *EventsourceConnection) Closed() <-chan struct{} {
+	return ec.closing
+}
+
+// Closing is for housekeeping works. It is safe to call it more than once.
 func (ec *EventsourceConnection) Closing() {
-	ec.closing <- true
+	ec.closingOnce.Do(func() {
+		close(ec.closing)
+	})
 }
 
 // Heartbeat registers a goroutine that periodically pings over the persistent connection so that the client
-// does not close the connection.
-func (ec *EventsourceConnection) Heartbeat() {
+// does not close the connection. The heartbeats are handed over to the publish function.
+func (ec *EventsourceConnection) Heartbeat(publish func(evt EventMessage)) {
 	go func() {
 		for {
 			select {
@@ -81,13 +328,47 @@ func (ec *EventsourceConnection) Heartbeat() {
 					ServerTime int64  `json:"server_time"`
 				}{Heartbeat: "OK", ServerTime: time.Now().Unix()}
 
-				msg := EventMessage{Event: HeartbeatEvent, DestinationID: ec.ConnectionID, Data: data}
-				ec.PublishEvent(msg)
+				// a client only needs the latest heartbeat, so pending heartbeats can be coalesced.
+				msg := EventMessage{Event: HeartbeatEvent, DestinationID: ec.ConnectionID, Data: data, CoalesceKey: string(HeartbeatEvent)}
+				publish(msg)
 			}
 		}
 	}()
 }
 
+// ConnectionInfo describes an open eventsource connection, on whichever node it is open.
+type ConnectionInfo struct {
+	ConnectionID string    `json:"connection_id"`
+	UserID       string    `json:"user_id"`
+	NodeID       string    `json:"node_id"`
+	UserAgent    string    `json:"user_agent"`
+	ConnectedAt  time.Time `json:"connected_at"`
+}
+
+// terminateConnectionEventVersion is the version of the TerminateConnectionEvent payload.
+const terminateConnectionEventVersion = 1
+
+// TerminateConnectionEvent asks the node owning the connection to disconnect it.
+type TerminateConnectionEvent struct {
+	ConnectionID string `json:"connection_id"`
+}
+
+func (e *TerminateConnectionEvent) GetTopic() string {
+	return TopicConnectionControl + ":" + e.ConnectionID
+}
+
+func (e *TerminateConnectionEvent) GetEvent() ServerEvent {
+	return TerminateConnectionServerEvent
+}
+
+func (e *TerminateConnectionEvent) GetVersion() int {
+	return terminateConnectionEventVersion
+}
+
+func (e *TerminateConnectionEvent) ToPublish(connID string) *PublishEvent {
+	return NewPublishableEvent(connID, e)
+}
+
 // ToJSON converts the PublishEvent to a JSON.
 func (pe *PublishEvent) ToJSON() (string, error) {
 	byts, err := json.Marshal(pe)
@@ -99,9 +380,13 @@ func (pe *PublishEvent) ToJSON() (string, error) {
 
 // EventMessage represents a single SSE Event.
 type EventMessage struct {
-	Event         ServerEvent // Event is the name of the event.
+	Event         ServerEvent `json:"event"`          // Event is the name of the event.
+	Sequence      int64       `json:"sequence"`       // Sequence numbers the events of a connection in the order they are queued
 	DestinationID string      `json:"destination_id"` // ConnectionID of the EventsourceConnection where this message should be delivered
 	Data          interface{} `json:"data"`           // Data is what we send in the response
+	CoalesceKey   string      `json:"-"`              // CoalesceKey identifies events that can replace each other in a full send buffer
+	Retry         int64       `json:"-"`              // Retry in milliseconds, tells the client how long to wait before reconnecting
+	QueuedAt      time.Time   `json:"-"`              // QueuedAt is when the event was queued for the connection
 }
 
 // String converts the event to a string eligible for publishing to SSE connection.
@@ -116,6 +401,10 @@ func (evt *EventMessage) String() string {
 		buff.WriteString(fmt.Sprintf("event: %s\n", evt.Event))
 	}
 
+	if evt.Retry > 0 {
+		buff.WriteString(fmt.Sprintf("retry: %d\n", evt.Retry))
+	}
+
 	byts, err := json.Marshal(evt.Data)
 	if err != nil {
 		byts = []byte("Not a valid JSON")
@@ -131,22 +420,39 @@ func (evt *EventMessage) String() string {
 	return buff.String()
 }
 
-// NewEventsourceConnection returns a new EventsourceConnection
-func NewEventsourceConnection(user *User) *EventsourceConnection {
+// NewEventsourceConnection returns a new EventsourceConnection which queues up to bufferSize events, applying the
+// overflow policy once the buffer is full.
+func NewEventsourceConnection(user *User, bufferSize int, policy OverflowPolicy) *EventsourceConnection {
 	id := uuid.NewV4()
 	ticker := time.NewTicker(time.Second * 20)
-	closingChan := make(chan bool)
+
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
 
 	eventsourceConnection := &EventsourceConnection{
-		ConnectionID: id.String(),
-		User:         user,
-		SendCh:       make(chan EventMessage),
-		ticker:       ticker,
-		closing:      closingChan,
+		ConnectionID:   id.String(),
+		User:           user,
+		ConnectedAt:    time.Now(),
+		bufferSize:     bufferSize,
+		overflowPolicy: policy,
+		subscriptions:  make(map[string]struct{}),
+		ready:          make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		ticker:         ticker,
+		closing:        make(chan struct{}),
 	}
 	return eventsourceConnection
 }
 
+// NewPublishableEvent returns a new PublishEvent for the publishable, carrying its SSE event and payload version.
+func NewPublishableEvent(connID string, data Publishable) *PublishEvent {
+	evt := NewPublishEvent(connID, data.GetTopic(), data)
+	evt.Event = data.GetEvent()
+	evt.Version = data.GetVersion()
+	return evt
+}
+
 // NewPublishEvent returns a new PublishEvent
 func NewPublishEvent(connID, topic string, payload interface{}) *PublishEvent {
 	return &PublishEvent{
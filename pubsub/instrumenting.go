@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/iamsayantan/messagerooms"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	next           Service
+}
+
+func (s *instrumentingService) Publish(ctx context.Context, data messagerooms.Publishable) (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "publish", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "publish").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Publish(ctx, data)
+}
+
+func (s *instrumentingService) Subscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "subscribe", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "subscribe").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Subscribe(ctx, connectionID, topics...)
+}
+
+func (s *instrumentingService) Unsubscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "unsubscribe", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "unsubscribe").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Unsubscribe(ctx, connectionID, topics...)
+}
+
+func (s *instrumentingService) HealthCheck(ctx context.Context) (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "health_check", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "health_check").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.HealthCheck(ctx)
+}
+
+func (s *instrumentingService) Close() (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "close", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "close").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.Close()
+}
+
+// NewInstrumentingService returns an instance of an instrumenting Service. The counter is labelled by method and
+// whether the call failed, the histogram by method.
+func NewInstrumentingService(counter metrics.Counter, latency metrics.Histogram, s Service) Service {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		next:           s,
+	}
+}
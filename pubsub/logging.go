@@ -0,0 +1,70 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+type loggingService struct {
+	logger *slog.Logger
+	next   Service
+}
+
+func (s *loggingService) Publish(ctx context.Context, data messagerooms.Publishable) (err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "publish", "topic", data.GetTopic(), "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.Publish(ctx, data)
+}
+
+func (s *loggingService) Subscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "subscribe", "connection_id", connectionID, "topics", len(topics), "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.Subscribe(ctx, connectionID, topics...)
+}
+
+func (s *loggingService) Unsubscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "unsubscribe", "connection_id", connectionID, "topics", len(topics), "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.Unsubscribe(ctx, connectionID, topics...)
+}
+
+func (s *loggingService) HealthCheck(ctx context.Context) (err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "health_check", "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.HealthCheck(ctx)
+}
+
+func (s *loggingService) Close() (err error) {
+	defer func(begin time.Time) {
+		s.log(context.Background(), err, "method", "close", "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.Close()
+}
+
+// log logs the call at debug level, or at error level if it failed.
+func (s *loggingService) log(ctx context.Context, err error, args ...any) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelError
+		args = append(args, "err", err)
+	}
+
+	s.logger.Log(ctx, level, "pubsub call", args...)
+}
+
+// NewLoggingService returns a new instance of a logging Service.
+func NewLoggingService(logger *slog.Logger, s Service) Service {
+	return &loggingService{logger: loggerOrDefault(logger), next: s}
+}
@@ -0,0 +1,249 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// DefaultNatsSubjectPrefix is the subject prefix used when none is configured.
+const DefaultNatsSubjectPrefix = "messagerooms"
+
+// ErrNatsConnectionClosed is returned by the nats subscriber once the underlying connection is closed.
+var ErrNatsConnectionClosed = errors.New("nats connection closed")
+
+// natsTopicSubscription keeps the nats subscription for a topic along with the local connections subscribed to it.
+type natsTopicSubscription struct {
+	sub           *nats.Subscription
+	connectionIDs map[string]struct{}
+}
+
+// natsPubsubService implements both Service and Subscriber on top of nats subjects. Unlike the redis
+// implementation, the list of subscribed connections is not kept in a shared store. Every node subscribes
+// to the subjects its own connections are interested in, and nats takes care of the fan out between nodes.
+type natsPubsubService struct {
+	conn          *nats.Conn
+	subjectPrefix string
+	logger        *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions map[string]*natsTopicSubscription // subscriptions keyed by topic
+
+	events    chan *messagerooms.PublishEvent
+	closed    chan struct{} // closed is closed when the nats connection is closed
+	stopped   chan struct{} // stopped is closed when the service is closed
+	closeOnce sync.Once
+}
+
+func (ns *natsPubsubService) Subscribe(ctx context.Context, connectionID string, topics ...string) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	for _, topic := range topics {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if ts, ok := ns.subscriptions[topic]; ok {
+			ts.connectionIDs[connectionID] = struct{}{}
+			continue
+		}
+
+		sub, err := ns.conn.Subscribe(ns.subject(topic), func(msg *nats.Msg) {
+			ns.dispatch(topic, msg)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "subscribing connection %s to topic %s", connectionID, topic)
+		}
+
+		ns.subscriptions[topic] = &natsTopicSubscription{
+			sub:           sub,
+			connectionIDs: map[string]struct{}{connectionID: {}},
+		}
+	}
+
+	return nil
+}
+
+func (ns *natsPubsubService) Unsubscribe(ctx context.Context, connectionID string, topics ...string) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	for _, topic := range topics {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ts, ok := ns.subscriptions[topic]
+		if !ok {
+			continue
+		}
+
+		delete(ts.connectionIDs, connectionID)
+		if len(ts.connectionIDs) > 0 {
+			continue
+		}
+
+		// no local connection is interested in the topic anymore, so the node does not need the subject either.
+		delete(ns.subscriptions, topic)
+		if err := ts.sub.Unsubscribe(); err != nil {
+			return errors.Wrapf(err, "unsubscribing connection %s from topic %s", connectionID, topic)
+		}
+	}
+
+	return nil
+}
+
+func (ns *natsPubsubService) Publish(ctx context.Context, data messagerooms.Publishable) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// the event is published once on the topic's subject, every node having subscribers for the topic
+	// prepares the event for its own connections.
+	topic := data.GetTopic()
+	publishEvent := data.ToPublish("")
+	publishEvent.RequestID = messagerooms.RequestIDFromContext(ctx)
+	publishEvent.TraceContext = injectTraceContext(ctx)
+	jsonEvent, err := json.Marshal(publishEvent)
+	if err != nil {
+		return errors.Wrapf(err, "encoding event for topic %s", topic)
+	}
+
+	if err := ns.conn.Publish(ns.subject(topic), jsonEvent); err != nil {
+		return errors.Wrapf(err, "publishing event for topic %s", topic)
+	}
+
+	return nil
+}
+
+func (ns *natsPubsubService) ReceiveEvents(handler func(evt *messagerooms.PublishEvent)) error {
+	for {
+		select {
+		case evt := <-ns.events:
+			handler(evt)
+		case <-ns.closed:
+			return ErrNatsConnectionClosed
+		case <-ns.stopped:
+			return ErrSubscriberClosed
+		}
+	}
+}
+
+// HealthCheck reports whether the nats connection is up, by waiting for the server to acknowledge a round trip. As
+// the same instance serves as the Service and the Subscriber, the check covers both. The context must have a
+// deadline.
+func (ns *natsPubsubService) HealthCheck(ctx context.Context) error {
+	select {
+	case <-ns.stopped:
+		return ErrSubscriberClosed
+	case <-ns.closed:
+		return ErrNatsConnectionClosed
+	default:
+	}
+
+	if status := ns.conn.Status(); status != nats.CONNECTED {
+		return errors.Errorf("nats connection is %s", status)
+	}
+
+	if err := ns.conn.FlushWithContext(ctx); err != nil {
+		return errors.Wrap(err, "flushing nats connection")
+	}
+
+	return nil
+}
+
+// Close stops the delivery of events and drops all the subscriptions of the node. As the same instance serves as
+// the Service and the Subscriber, it is safe to call Close for both.
+func (ns *natsPubsubService) Close() error {
+	var err error
+	ns.closeOnce.Do(func() {
+		close(ns.stopped)
+
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+
+		for topic, ts := range ns.subscriptions {
+			if unsubErr := ts.sub.Unsubscribe(); unsubErr != nil && err == nil {
+				err = errors.Wrapf(unsubErr, "unsubscribing from topic %s", topic)
+			}
+		}
+		ns.subscriptions = make(map[string]*natsTopicSubscription)
+	})
+
+	return err
+}
+
+// dispatch prepares a copy of the received event for each local connection subscribed to the topic.
+func (ns *natsPubsubService) dispatch(topic string, msg *nats.Msg) {
+	var evt messagerooms.PublishEvent
+	if err := json.Unmarshal(msg.Data, &evt); err != nil {
+		ns.logger.Warn("invalid event received", "subject", msg.Subject, "err", err)
+		return
+	}
+
+	ns.logger.Debug("event received", "subject", msg.Subject, "topic", evt.Topic, "request_id", evt.RequestID)
+
+	ns.mu.Lock()
+	var connIDs []string
+	if ts, ok := ns.subscriptions[topic]; ok {
+		for connID := range ts.connectionIDs {
+			connIDs = append(connIDs, connID)
+		}
+	}
+	ns.mu.Unlock()
+
+	for _, connID := range connIDs {
+		connEvt := evt
+		connEvt.ConnectionID = connID
+
+		select {
+		case ns.events <- &connEvt:
+		case <-ns.closed:
+			return
+		case <-ns.stopped:
+			return
+		}
+	}
+}
+
+func (ns *natsPubsubService) subject(topic string) string {
+	return natsSubject(ns.subjectPrefix, topic)
+}
+
+// natsSubject maps a topic to its nats subject. Topics are in the format of topicName:identifier, which becomes
+// prefix.topicName.identifier. Characters that have a special meaning in nats subjects are replaced.
+func natsSubject(prefix, topic string) string {
+	replacer := strings.NewReplacer(":", ".", " ", "_", "*", "_", ">", "_")
+	return prefix + "." + replacer.Replace(topic)
+}
+
+// NewNatsPubsub returns the nats implementation of the pubsub Service along with the Subscriber the hub
+// should receive its events from. Both share the same state, so they must be used together.
+func NewNatsPubsub(conn *nats.Conn, subjectPrefix string, logger *slog.Logger) (Service, Subscriber) {
+	if subjectPrefix == "" {
+		subjectPrefix = DefaultNatsSubjectPrefix
+	}
+
+	ns := &natsPubsubService{
+		conn:          conn,
+		subjectPrefix: subjectPrefix,
+		logger:        loggerOrDefault(logger),
+		subscriptions: make(map[string]*natsTopicSubscription),
+		events:        make(chan *messagerooms.PublishEvent),
+		closed:        make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	conn.SetClosedHandler(func(_ *nats.Conn) {
+		close(ns.closed)
+	})
+
+	return ns, ns
+}
@@ -0,0 +1,294 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// DefaultNatsGatherTimeout is how long the nats registry waits for the nodes to report their connections when none
+// is configured.
+const DefaultNatsGatherTimeout = 250 * time.Millisecond
+
+// Tokens of the registry subjects, they separate them from the topic subjects.
+const (
+	natsConnectionsSubjectToken = "_connections"
+	natsNodesSubjectToken       = "_nodes"
+)
+
+// natsNodeAnnouncement is published by a node when it starts and when it leaves, so that the other nodes know whom to
+// expect replies from.
+type natsNodeAnnouncement struct {
+	NodeID  string `json:"node_id"`
+	Leaving bool   `json:"leaving,omitempty"`
+}
+
+// natsConnectionsReply is the reply of a node to a request for the connections of a user.
+type natsConnectionsReply struct {
+	NodeID      string                        `json:"node_id"`
+	Connections []messagerooms.ConnectionInfo `json:"connections"`
+}
+
+// natsConnectionRegistry keeps the registered connections on the node that owns them. The connections of a user
+// are gathered by asking every node over the request subject, each node replies with its connections of the user,
+// none if it has no such connection. The nodes announce themselves when they start and leave, so the gathering stops
+// as soon as every known node replied. A node that does not reply before the gather timeout is taken for dead and
+// is not waited for anymore, until it is heard from again.
+type natsConnectionRegistry struct {
+	conn          *nats.Conn
+	nodeID        string
+	subjectPrefix string
+	gatherTimeout time.Duration
+	logger        *slog.Logger
+
+	mu          sync.Mutex
+	connections map[string]map[string]messagerooms.ConnectionInfo // connections of this node keyed by user and connection id
+	nodes       map[string]struct{}                               // nodes holds the ids of the nodes expected to reply, this node included
+	subs        []*nats.Subscription                              // subs holds the subscriptions to the registry subjects
+}
+
+func (nr *natsConnectionRegistry) Register(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	if nr.connections[info.UserID] == nil {
+		nr.connections[info.UserID] = make(map[string]messagerooms.ConnectionInfo)
+	}
+
+	nr.connections[info.UserID][info.ConnectionID] = info
+	return nil
+}
+
+func (nr *natsConnectionRegistry) Deregister(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	delete(nr.connections[info.UserID], info.ConnectionID)
+	if len(nr.connections[info.UserID]) == 0 {
+		delete(nr.connections, info.UserID)
+	}
+
+	return nil
+}
+
+// UserConnections asks all the nodes for the connections of the user and collects the replies until every known
+// node replied, or the gather timeout. The nodes that did not reply in time are forgotten, so a dead node delays a
+// single gathering only.
+func (nr *natsConnectionRegistry) UserConnections(ctx context.Context, userID string) ([]messagerooms.ConnectionInfo, error) {
+	replies := make(chan *nats.Msg, 64)
+	inbox := nats.NewInbox()
+	sub, err := nr.conn.ChanSubscribe(inbox, replies)
+	if err != nil {
+		return nil, errors.Wrapf(err, "gathering connections of user %s", userID)
+	}
+	defer func() {
+		_ = sub.Unsubscribe()
+	}()
+
+	nr.mu.Lock()
+	pending := make(map[string]struct{}, len(nr.nodes))
+	for nodeID := range nr.nodes {
+		pending[nodeID] = struct{}{}
+	}
+	nr.mu.Unlock()
+
+	if err := nr.conn.PublishRequest(nr.subject(natsConnectionsSubjectToken), inbox, []byte(userID)); err != nil {
+		return nil, errors.Wrapf(err, "gathering connections of user %s", userID)
+	}
+
+	timer := time.NewTimer(nr.gatherTimeout)
+	defer timer.Stop()
+
+	var connections []messagerooms.ConnectionInfo
+	for len(pending) > 0 {
+		select {
+		case msg := <-replies:
+			var reply natsConnectionsReply
+			if err := json.Unmarshal(msg.Data, &reply); err != nil {
+				nr.logger.Warn("invalid connections received", "subject", msg.Subject, "err", err)
+				continue
+			}
+
+			connections = append(connections, reply.Connections...)
+			delete(pending, reply.NodeID)
+			nr.addNode(reply.NodeID)
+		case <-timer.C:
+			nr.mu.Lock()
+			for nodeID := range pending {
+				delete(nr.nodes, nodeID)
+			}
+			nr.mu.Unlock()
+
+			nr.logger.Warn("nodes did not report their connections in time", "user_id", userID, "nodes", len(pending))
+			return connections, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return connections, nil
+}
+
+// Close drops the registry subscriptions and tells the other nodes this node left, its connections are no longer
+// reported.
+func (nr *natsConnectionRegistry) Close() error {
+	nr.mu.Lock()
+	defer nr.mu.Unlock()
+
+	var err error
+	for _, sub := range nr.subs {
+		if unsubErr := sub.Unsubscribe(); unsubErr != nil && err == nil {
+			err = errors.Wrap(unsubErr, "unsubscribing registry")
+		}
+	}
+
+	if announceErr := nr.announce(nr.subject(natsNodesSubjectToken), "", true); announceErr != nil && err == nil {
+		err = announceErr
+	}
+
+	nr.subs = nil
+	nr.connections = make(map[string]map[string]messagerooms.ConnectionInfo)
+
+	return err
+}
+
+// reply answers a request for the connections of a user with the ones open on this node.
+func (nr *natsConnectionRegistry) reply(msg *nats.Msg) {
+	userID := string(msg.Data)
+
+	nr.mu.Lock()
+	reply := natsConnectionsReply{
+		NodeID:      nr.nodeID,
+		Connections: make([]messagerooms.ConnectionInfo, 0, len(nr.connections[userID])),
+	}
+	for _, info := range nr.connections[userID] {
+		reply.Connections = append(reply.Connections, info)
+	}
+	nr.mu.Unlock()
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		nr.logger.Error("encoding connections", "user_id", userID, "err", err)
+		return
+	}
+
+	if err := msg.Respond(data); err != nil {
+		nr.logger.Error("replying connections", "user_id", userID, "err", err)
+	}
+}
+
+// handleAnnouncement keeps track of the nodes announcing themselves. A starting node asks for a reply, so that it
+// learns about the nodes already running.
+func (nr *natsConnectionRegistry) handleAnnouncement(msg *nats.Msg) {
+	var announcement natsNodeAnnouncement
+	if err := json.Unmarshal(msg.Data, &announcement); err != nil {
+		nr.logger.Warn("invalid node announcement received", "subject", msg.Subject, "err", err)
+		return
+	}
+
+	if announcement.NodeID == nr.nodeID {
+		return
+	}
+
+	if announcement.Leaving {
+		nr.mu.Lock()
+		delete(nr.nodes, announcement.NodeID)
+		nr.mu.Unlock()
+		return
+	}
+
+	nr.addNode(announcement.NodeID)
+	if msg.Reply == "" {
+		return
+	}
+
+	if err := nr.announce(msg.Reply, "", false); err != nil {
+		nr.logger.Error("announcing node", "err", err)
+	}
+}
+
+// announce publishes the announcement of this node to the subject, asking for replies on reply if it's not empty.
+func (nr *natsConnectionRegistry) announce(subject, reply string, leaving bool) error {
+	data, err := json.Marshal(natsNodeAnnouncement{NodeID: nr.nodeID, Leaving: leaving})
+	if err != nil {
+		return errors.Wrap(err, "encoding node announcement")
+	}
+
+	if reply == "" {
+		err = nr.conn.Publish(subject, data)
+	} else {
+		err = nr.conn.PublishRequest(subject, reply, data)
+	}
+
+	return errors.Wrap(err, "announcing node")
+}
+
+func (nr *natsConnectionRegistry) addNode(nodeID string) {
+	nr.mu.Lock()
+	nr.nodes[nodeID] = struct{}{}
+	nr.mu.Unlock()
+}
+
+// subject returns the registry subject of the token.
+func (nr *natsConnectionRegistry) subject(token string) string {
+	return natsSubject(nr.subjectPrefix, token)
+}
+
+// NewNatsConnectionRegistry returns the nats implementation of the ConnectionRegistry, for the node with the id.
+// Listing the connections of a user waits for the replies of the nodes for gatherTimeout at most.
+func NewNatsConnectionRegistry(conn *nats.Conn, nodeID, subjectPrefix string, gatherTimeout time.Duration, logger *slog.Logger) ConnectionRegistry {
+	if subjectPrefix == "" {
+		subjectPrefix = DefaultNatsSubjectPrefix
+	}
+
+	if gatherTimeout <= 0 {
+		gatherTimeout = DefaultNatsGatherTimeout
+	}
+
+	nr := &natsConnectionRegistry{
+		conn:          conn,
+		nodeID:        nodeID,
+		subjectPrefix: subjectPrefix,
+		gatherTimeout: gatherTimeout,
+		logger:        loggerOrDefault(logger),
+		connections:   make(map[string]map[string]messagerooms.ConnectionInfo),
+		nodes:         map[string]struct{}{nodeID: {}},
+	}
+
+	// the replies of the other nodes to the announcement are published on the announcement subject, no one asks for
+	// a reply to them.
+	nodesSubject := nr.subject(natsNodesSubjectToken)
+	for subject, handler := range map[string]nats.MsgHandler{
+		nr.subject(natsConnectionsSubjectToken): nr.reply,
+		nodesSubject:                            nr.handleAnnouncement,
+	} {
+		sub, err := conn.Subscribe(subject, handler)
+		if err != nil {
+			nr.logger.Error("subscribing registry", "subject", subject, "err", err)
+			continue
+		}
+
+		nr.subs = append(nr.subs, sub)
+	}
+
+	// the subscriptions must reach the server before the announcement, or the replies to it could be missed.
+	if err := conn.Flush(); err != nil {
+		nr.logger.Error("flushing registry subscriptions", "err", err)
+	}
+
+	if err := nr.announce(nodesSubject, nodesSubject, false); err != nil {
+		nr.logger.Error("announcing node", "err", err)
+	}
+
+	return nr
+}
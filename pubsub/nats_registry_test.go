@@ -0,0 +1,82 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// gatherConnections lists the connections of the user, and fails the test if it takes the whole gather timeout.
+func gatherConnections(t *testing.T, registry ConnectionRegistry, userID string, want int) {
+	t.Helper()
+
+	start := time.Now()
+	connections, err := registry.UserConnections(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("gathering connections: %v", err)
+	}
+
+	if len(connections) != want {
+		t.Errorf("gathered connections = %+v, want %d", connections, want)
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("gathering took %s, want it to stop once every node replied", elapsed)
+	}
+}
+
+func TestNatsRegistryGathersFromKnownNodes(t *testing.T) {
+	srv := runNatsServer(t)
+	first := NewNatsConnectionRegistry(connectNats(t, srv), "node-1", "test", 2*time.Second, nil)
+	second := NewNatsConnectionRegistry(connectNats(t, srv), "node-2", "test", 2*time.Second, nil)
+	t.Cleanup(func() { _ = first.Close() })
+
+	for i, registry := range []ConnectionRegistry{first, second} {
+		info := messagerooms.ConnectionInfo{ConnectionID: "conn-" + string(rune('1'+i)), UserID: "alice"}
+		if err := registry.Register(context.Background(), info); err != nil {
+			t.Fatalf("registering connection: %v", err)
+		}
+	}
+
+	// the first node learns about the second one from its announcement, asynchronously.
+	time.Sleep(100 * time.Millisecond)
+	gatherConnections(t, first, "alice", 2)
+	gatherConnections(t, second, "alice", 2)
+	gatherConnections(t, first, "bob", 0)
+
+	// a node leaving is not waited for anymore.
+	if err := second.Close(); err != nil {
+		t.Fatalf("closing registry: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	gatherConnections(t, first, "alice", 1)
+}
+
+func TestNatsRegistryForgetsDeadNodes(t *testing.T) {
+	srv := runNatsServer(t)
+	first := NewNatsConnectionRegistry(connectNats(t, srv), "node-1", "test", 300*time.Millisecond, nil)
+	t.Cleanup(func() { _ = first.Close() })
+
+	// the second node dies without telling the others.
+	nc := connectNats(t, srv)
+	_ = NewNatsConnectionRegistry(nc, "node-2", "test", 300*time.Millisecond, nil)
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flushing: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	nc.Close()
+
+	start := time.Now()
+	if _, err := first.UserConnections(context.Background(), "alice"); err != nil {
+		t.Fatalf("gathering connections: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("gathering took %s, want it to wait for the dead node until the timeout", elapsed)
+	}
+
+	gatherConnections(t, first, "alice", 0)
+}
@@ -0,0 +1,237 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/nats-io/nats-server/v2/server"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+)
+
+func runNatsServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	opts := natsserver.DefaultTestOptions
+	opts.Port = server.RANDOM_PORT
+	srv := natsserver.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	return srv
+}
+
+func connectNats(t *testing.T, srv *server.Server) *nats.Conn {
+	t.Helper()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("could not connect to nats: %s", err)
+	}
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+// receive starts receiving events from the subscriber and returns the channel they are forwarded to.
+func receive(sub Subscriber) <-chan *messagerooms.PublishEvent {
+	received := make(chan *messagerooms.PublishEvent, 10)
+	go func() {
+		_ = sub.ReceiveEvents(func(evt *messagerooms.PublishEvent) {
+			received <- evt
+		})
+	}()
+
+	return received
+}
+
+func expectEvent(t *testing.T, received <-chan *messagerooms.PublishEvent) *messagerooms.PublishEvent {
+	t.Helper()
+
+	select {
+	case evt := <-received:
+		return evt
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return nil
+	}
+}
+
+func expectNoEvent(t *testing.T, received <-chan *messagerooms.PublishEvent) {
+	t.Helper()
+
+	select {
+	case evt := <-received:
+		t.Fatalf("unexpected event for connection %s on topic %s", evt.ConnectionID, evt.Topic)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNatsPubsubDeliversToSubscribedConnections(t *testing.T) {
+	srv := runNatsServer(t)
+
+	// two nodes, each with its own connection to nats.
+	publisher, _ := NewNatsPubsub(connectNats(t, srv), "test", nil)
+	service, subscriber := NewNatsPubsub(connectNats(t, srv), "test", nil)
+	received := receive(subscriber)
+
+	usr := messagerooms.User{ID: "user-1", Nickname: "alice"}
+	if err := service.Subscribe(context.Background(), "conn-1", usr.GetPersonalTopics()...); err != nil {
+		t.Fatalf("could not subscribe: %s", err)
+	}
+
+	// make sure the subscription is registered with the server before publishing from the other node.
+	if err := service.(*natsPubsubService).conn.Flush(); err != nil {
+		t.Fatalf("could not flush: %s", err)
+	}
+
+	err := publisher.Publish(context.Background(), &messagerooms.NewMessageEvent{User: usr, Message: messagerooms.Message{ID: "message-1"}})
+	if err != nil {
+		t.Fatalf("could not publish: %s", err)
+	}
+
+	evt := expectEvent(t, received)
+	if evt.ConnectionID != "conn-1" {
+		t.Errorf("expected connection id conn-1, got %s", evt.ConnectionID)
+	}
+	if evt.Topic != usr.GetPersonalTopics()[0] {
+		t.Errorf("expected topic %s, got %s", usr.GetPersonalTopics()[0], evt.Topic)
+	}
+
+	// messages for other users must not be delivered to the connection.
+	err = publisher.Publish(context.Background(), &messagerooms.NewMessageEvent{User: messagerooms.User{ID: "user-2"}})
+	if err != nil {
+		t.Fatalf("could not publish: %s", err)
+	}
+	expectNoEvent(t, received)
+}
+
+func TestNatsPubsubUnsubscribe(t *testing.T) {
+	srv := runNatsServer(t)
+
+	service, subscriber := NewNatsPubsub(connectNats(t, srv), "test", nil)
+	received := receive(subscriber)
+
+	usr := messagerooms.User{ID: "user-1", Nickname: "alice"}
+	topic := usr.GetPersonalTopics()[0]
+	ctx := context.Background()
+
+	if err := service.Subscribe(ctx, "conn-1", topic); err != nil {
+		t.Fatalf("could not subscribe: %s", err)
+	}
+	if err := service.Subscribe(ctx, "conn-2", topic); err != nil {
+		t.Fatalf("could not subscribe: %s", err)
+	}
+	if err := service.Unsubscribe(ctx, "conn-1", topic); err != nil {
+		t.Fatalf("could not unsubscribe: %s", err)
+	}
+
+	if err := service.Publish(ctx, &messagerooms.NewMessageEvent{User: usr}); err != nil {
+		t.Fatalf("could not publish: %s", err)
+	}
+
+	evt := expectEvent(t, received)
+	if evt.ConnectionID != "conn-2" {
+		t.Errorf("expected connection id conn-2, got %s", evt.ConnectionID)
+	}
+	expectNoEvent(t, received)
+
+	if err := service.Unsubscribe(ctx, "conn-2", topic); err != nil {
+		t.Fatalf("could not unsubscribe: %s", err)
+	}
+	if _, ok := service.(*natsPubsubService).subscriptions[topic]; ok {
+		t.Errorf("expected subscription for topic %s to be removed", topic)
+	}
+}
+
+func TestNatsPubsubPublishHonoursContext(t *testing.T) {
+	srv := runNatsServer(t)
+
+	service, _ := NewNatsPubsub(connectNats(t, srv), "test", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := service.Publish(ctx, &messagerooms.NewMessageEvent{}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := service.Subscribe(ctx, "conn-1", "NewMessage:user-1"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestNatsSubscriberStopsWhenConnectionCloses(t *testing.T) {
+	srv := runNatsServer(t)
+
+	nc := connectNats(t, srv)
+	_, subscriber := NewNatsPubsub(nc, "test", nil)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- subscriber.ReceiveEvents(func(evt *messagerooms.PublishEvent) {})
+	}()
+
+	nc.Close()
+
+	select {
+	case err := <-errCh:
+		if err != ErrNatsConnectionClosed {
+			t.Errorf("expected ErrNatsConnectionClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not stop after the connection was closed")
+	}
+}
+
+func TestNatsSubjectMapping(t *testing.T) {
+	ns := &natsPubsubService{subjectPrefix: "rooms"}
+
+	tests := map[string]string{
+		"NewMessage:user-1": "rooms.NewMessage.user-1",
+		"NewRoom:a b":       "rooms.NewRoom.a_b",
+		"NewRoom:*>":        "rooms.NewRoom.__",
+	}
+
+	for topic, want := range tests {
+		if got := ns.subject(topic); got != want {
+			t.Errorf("subject(%q) = %q, want %q", topic, got, want)
+		}
+	}
+}
+
+func TestNatsSubscriberClose(t *testing.T) {
+	srv := runNatsServer(t)
+
+	service, subscriber := NewNatsPubsub(connectNats(t, srv), "test", nil)
+	if err := service.Subscribe(context.Background(), "conn-1", "NewMessage:user-1"); err != nil {
+		t.Fatalf("could not subscribe: %s", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- subscriber.ReceiveEvents(func(evt *messagerooms.PublishEvent) {})
+	}()
+
+	if err := subscriber.Close(); err != nil {
+		t.Fatalf("could not close subscriber: %s", err)
+	}
+
+	// the service and the subscriber are the same instance, closing it twice must be fine.
+	if err := service.Close(); err != nil {
+		t.Fatalf("could not close service: %s", err)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != ErrSubscriberClosed {
+			t.Errorf("expected ErrSubscriberClosed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not stop after it was closed")
+	}
+
+	if n := len(service.(*natsPubsubService).subscriptions); n != 0 {
+		t.Errorf("expected no subscriptions after close, got %d", n)
+	}
+}
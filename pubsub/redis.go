@@ -0,0 +1,735 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/gomodule/redigo/redis"
+	"github.com/iamsayantan/messagerooms"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// minReconnectBackoff is the initial wait time before the subscriber reconnects to redis.
+	minReconnectBackoff = 500 * time.Millisecond
+
+	// maxReconnectBackoff is the maximum wait time between two reconnection attempts.
+	maxReconnectBackoff = 30 * time.Second
+
+	// defaultLeaseTTL is the subscription lease duration used when none is configured.
+	defaultLeaseTTL = 30 * time.Second
+
+	// defaultHealthCheckInterval is used for pinging the subscription connection when no interval is configured.
+	defaultHealthCheckInterval = time.Minute
+)
+
+// RedisConfig holds the options for connecting to redis.
+type RedisConfig struct {
+	Addr          string // Addr is the host:port of the redis server
+	Password      string // Password used for AUTH, if empty no AUTH is sent
+	DB            int    // DB is the database selected after connecting
+	TLS           bool   // TLS enables TLS for the connection
+	TLSSkipVerify bool   // TLSSkipVerify disables server certificate verification when TLS is enabled
+
+	PoolSize int // PoolSize is the maximum number of connections allocated by the pool, zero means no limit
+	MaxIdle  int // MaxIdle is the maximum number of idle connections kept in the pool
+
+	ConnectTimeout time.Duration // ConnectTimeout limits the time spent on establishing a connection
+	ReadTimeout    time.Duration // ReadTimeout limits the time waiting for a reply to a command
+	WriteTimeout   time.Duration // WriteTimeout limits the time spent on writing a command
+	IdleTimeout    time.Duration // IdleTimeout closes connections that stayed idle in the pool for this duration
+
+	// HealthCheckInterval is the idle time after which a pooled connection is pinged before being reused. The
+	// subscription connection is pinged with the same interval, and reconnected if the ping goes unanswered.
+	HealthCheckInterval time.Duration
+
+	// CommandLatency observes the round trip seconds of the redis commands, labelled by command. Pipelined commands
+	// are observed as part of the command that reads their replies, like EXEC. If nil, nothing is observed.
+	CommandLatency metrics.Histogram
+
+	// Tracer traces the commands sent with a context, so they show up in the trace of the request that sent them.
+	// If nil, nothing is traced.
+	Tracer trace.Tracer
+}
+
+// NewRedisPool returns a connection pool for the given configuration. The pool is safe for concurrent use.
+func NewRedisPool(cfg RedisConfig) *redis.Pool {
+	return &redis.Pool{
+		MaxActive:   cfg.PoolSize,
+		MaxIdle:     cfg.MaxIdle,
+		IdleTimeout: cfg.IdleTimeout,
+		Wait:        true,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			conn, err := redis.DialContext(ctx, "tcp", cfg.Addr,
+				redis.DialPassword(cfg.Password),
+				redis.DialDatabase(cfg.DB),
+				redis.DialUseTLS(cfg.TLS),
+				redis.DialTLSSkipVerify(cfg.TLSSkipVerify),
+				redis.DialConnectTimeout(cfg.ConnectTimeout),
+				redis.DialReadTimeout(cfg.ReadTimeout),
+				redis.DialWriteTimeout(cfg.WriteTimeout),
+			)
+			if err != nil || (cfg.CommandLatency == nil && cfg.Tracer == nil) {
+				return conn, err
+			}
+
+			return &instrumentedConn{Conn: conn, latency: cfg.CommandLatency, tracer: cfg.Tracer}, nil
+		},
+		TestOnBorrow: func(c redis.Conn, lastUsed time.Time) error {
+			if time.Since(lastUsed) < cfg.HealthCheckInterval {
+				return nil
+			}
+
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// instrumentedConn observes the round trip time of the commands sent over the connection, and traces the ones sent
+// with a context. It implements the optional context and timeout interfaces of the connection, as the pool relies
+// on them.
+type instrumentedConn struct {
+	redis.Conn
+	latency metrics.Histogram
+	tracer  trace.Tracer
+}
+
+func (ic *instrumentedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	defer ic.observe(commandName, time.Now())
+	return ic.Conn.Do(commandName, args...)
+}
+
+func (ic *instrumentedConn) DoContext(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
+	defer ic.observe(commandName, time.Now())
+
+	if ic.tracer != nil && commandName != "" {
+		var span trace.Span
+		ctx, span = ic.tracer.Start(ctx, "redis "+strings.ToUpper(commandName),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", strings.ToUpper(commandName)),
+			),
+		)
+		defer func() { endSpan(span, err) }()
+	}
+
+	return redis.DoContext(ic.Conn, ctx, commandName, args...)
+}
+
+func (ic *instrumentedConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	defer ic.observe(commandName, time.Now())
+	return redis.DoWithTimeout(ic.Conn, timeout, commandName, args...)
+}
+
+func (ic *instrumentedConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	return redis.ReceiveContext(ic.Conn, ctx)
+}
+
+func (ic *instrumentedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(ic.Conn, timeout)
+}
+
+// observe records the time since start for the command. An empty command only flushes the pipelined commands, the
+// time is accounted to the command reading their replies instead.
+func (ic *instrumentedConn) observe(commandName string, start time.Time) {
+	if commandName == "" || ic.latency == nil {
+		return
+	}
+
+	ic.latency.With("command", strings.ToUpper(commandName)).Observe(time.Since(start).Seconds())
+}
+
+// Redis keys used for keeping track of the subscriptions. Subscriptions of a topic are kept in a sorted set scored
+// by their lease expiry, every node also records the subscriptions it owns so that they can be purged if the node
+// dies without unsubscribing its connections.
+const (
+	redisNodesKey                = "nodes"
+	redisSubscriptionsKeyPrefix  = "subscriptions:"
+	redisNodeSubscriptionsKeyFmt = "node:%s:subscriptions"
+)
+
+// redisPubsubService keeps track of the subscriptions of the connections open on this node. The subscriptions are
+// leased, the node renews the leases with a heartbeat, and a janitor purges the subscriptions of the nodes that
+// stopped renewing them.
+type redisPubsubService struct {
+	pool     *redis.Pool
+	nodeID   string
+	leaseTTL time.Duration
+	logger   *slog.Logger
+
+	mu            sync.Mutex
+	subscriptions map[string]map[string]struct{} // subscriptions holds the topics keyed by local connection id
+
+	// renewing is held for writing while the leases are renewed, and for reading while a connection is (un)subscribed,
+	// so a renewal never writes back a subscription removed after it took its snapshot.
+	renewing sync.RWMutex
+
+	quit      chan struct{} // quit is closed to stop the heartbeat and the janitor
+	closeOnce sync.Once
+}
+
+func (rs *redisPubsubService) Subscribe(ctx context.Context, connectionID string, topics ...string) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	rs.renewing.RLock()
+	defer rs.renewing.RUnlock()
+
+	// all the topics are subscribed in a single transaction, so either the connection is subscribed to all
+	// of them or none.
+	expiry := rs.leaseExpiry()
+	if err := conn.Send("MULTI"); err != nil {
+		return errors.Wrap(err, "subscribing connection "+connectionID)
+	}
+
+	for _, topic := range topics {
+		if err := rs.sendSubscribe(conn, expiry, connectionID, topic); err != nil {
+			return errors.Wrapf(err, "subscribing connection %s to topic %s", connectionID, topic)
+		}
+	}
+
+	if err := conn.Send("ZADD", redisNodesKey, expiry, rs.nodeID); err != nil {
+		return errors.Wrap(err, "subscribing connection "+connectionID)
+	}
+
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return errors.Wrap(err, "subscribing connection "+connectionID)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.subscriptions[connectionID]; !ok {
+		rs.subscriptions[connectionID] = make(map[string]struct{})
+	}
+
+	for _, topic := range topics {
+		rs.subscriptions[connectionID][topic] = struct{}{}
+	}
+
+	return nil
+}
+
+func (rs *redisPubsubService) Unsubscribe(ctx context.Context, connectionID string, topics ...string) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	rs.renewing.RLock()
+	defer rs.renewing.RUnlock()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return errors.Wrap(err, "unsubscribing connection "+connectionID)
+	}
+
+	for _, topic := range topics {
+		if err := conn.Send("ZREM", redisSubscriptionsKeyPrefix+topic, connectionID); err != nil {
+			return errors.Wrapf(err, "unsubscribing connection %s from topic %s", connectionID, topic)
+		}
+
+		if err := conn.Send("SREM", rs.nodeSubscriptionsKey(rs.nodeID), subscriptionMember(connectionID, topic)); err != nil {
+			return errors.Wrapf(err, "unsubscribing connection %s from topic %s", connectionID, topic)
+		}
+	}
+
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return errors.Wrap(err, "unsubscribing connection "+connectionID)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(rs.subscriptions[connectionID], topic)
+	}
+
+	if len(rs.subscriptions[connectionID]) == 0 {
+		delete(rs.subscriptions, connectionID)
+	}
+
+	return nil
+}
+
+func (rs *redisPubsubService) Publish(ctx context.Context, data messagerooms.Publishable) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	// for publishing data we find all the connection id that is subscribed to the given topic and prepare
+	// event for all of those connection ids and publish. subscriptions whose lease has expired were left behind,
+	// by a dead node or a failed unsubscribe, so they are removed from the topic first.
+	topic := data.GetTopic()
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	if err := conn.Send("ZREMRANGEBYSCORE", redisSubscriptionsKeyPrefix+topic, "-inf", fmt.Sprintf("(%d", now)); err != nil {
+		return errors.Wrapf(err, "pruning subscribers of topic %s", topic)
+	}
+
+	connIDs, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", redisSubscriptionsKeyPrefix+topic, now, "+inf"))
+	if err != nil {
+		return errors.Wrapf(err, "fetching subscribers of topic %s", topic)
+	}
+
+	requestID := messagerooms.RequestIDFromContext(ctx)
+	traceContext := injectTraceContext(ctx)
+	for _, connID := range connIDs {
+		publishEvent := data.ToPublish(connID)
+		publishEvent.RequestID = requestID
+		publishEvent.TraceContext = traceContext
+		jsonEvent, err := publishEvent.ToJSON()
+		if err != nil {
+			return errors.Wrapf(err, "encoding event for topic %s", topic)
+		}
+
+		if _, err := redis.DoContext(conn, ctx, "PUBLISH", messagerooms.HubChannel, jsonEvent); err != nil {
+			return errors.Wrapf(err, "publishing event for topic %s", topic)
+		}
+	}
+
+	return nil
+}
+
+// HealthCheck pings redis over a connection of the pool.
+func (rs *redisPubsubService) HealthCheck(ctx context.Context) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	if _, err := redis.DoContext(conn, ctx, "PING"); err != nil {
+		return errors.Wrap(err, "pinging redis")
+	}
+
+	return nil
+}
+
+// heartbeat periodically renews the leases of the node and all its subscriptions. The subscriptions are written
+// again rather than just refreshed, so if the janitor of another node purged them while this node could not
+// reach redis, they are restored. The subscriptions recorded for the node are rewritten as well, dropping the ones
+// left behind by a failed subscribe.
+func (rs *redisPubsubService) heartbeat() {
+	interval := rs.leaseTTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.quit:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := rs.renewLeases(ctx); err != nil {
+				rs.logger.Error("renewing subscription leases", "err", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (rs *redisPubsubService) renewLeases(ctx context.Context) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	// the leases are renewed before any other subscription changes, a concurrent unsubscribe would be undone otherwise.
+	rs.renewing.Lock()
+	defer rs.renewing.Unlock()
+
+	expiry := rs.leaseExpiry()
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+
+	if err := conn.Send("DEL", rs.nodeSubscriptionsKey(rs.nodeID)); err != nil {
+		return err
+	}
+
+	rs.mu.Lock()
+	for connID, topics := range rs.subscriptions {
+		for topic := range topics {
+			if err := rs.sendSubscribe(conn, expiry, connID, topic); err != nil {
+				rs.mu.Unlock()
+				return err
+			}
+		}
+	}
+	rs.mu.Unlock()
+
+	if err := conn.Send("ZADD", redisNodesKey, expiry, rs.nodeID); err != nil {
+		return err
+	}
+
+	_, err = redis.DoContext(conn, ctx, "EXEC")
+	return err
+}
+
+// janitor periodically purges the subscriptions of the nodes whose lease has expired. Every node runs the janitor,
+// purging is idempotent so it does not matter which node gets to it first.
+func (rs *redisPubsubService) janitor() {
+	ticker := time.NewTicker(rs.leaseTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.quit:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), rs.leaseTTL)
+			if err := rs.purgeDeadNodes(ctx); err != nil {
+				rs.logger.Error("purging subscriptions of dead nodes", "err", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (rs *redisPubsubService) purgeDeadNodes(ctx context.Context) error {
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	nodeIDs, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", redisNodesKey, "-inf", now))
+	if err != nil {
+		return errors.Wrap(err, "fetching dead nodes")
+	}
+
+	for _, nodeID := range nodeIDs {
+		// this node is clearly alive, its heartbeat will restore the lease.
+		if nodeID == rs.nodeID {
+			continue
+		}
+
+		purged, err := rs.purgeNode(ctx, conn, nodeID)
+		if err != nil {
+			return err
+		}
+
+		rs.logger.Info("purged subscriptions of dead node", "dead_node", nodeID, "subscriptions", purged)
+	}
+
+	return nil
+}
+
+// purgeNode removes all the subscriptions owned by the node along with the node itself, returning the number of
+// subscriptions removed.
+func (rs *redisPubsubService) purgeNode(ctx context.Context, conn redis.Conn, nodeID string) (int, error) {
+	members, err := redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", rs.nodeSubscriptionsKey(nodeID)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "fetching subscriptions of node %s", nodeID)
+	}
+
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+
+	for _, member := range members {
+		connID, topic := parseSubscriptionMember(member)
+		if err := conn.Send("ZREM", redisSubscriptionsKeyPrefix+topic, connID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := conn.Send("DEL", rs.nodeSubscriptionsKey(nodeID)); err != nil {
+		return 0, err
+	}
+
+	if err := conn.Send("ZREM", redisNodesKey, nodeID); err != nil {
+		return 0, err
+	}
+
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return 0, errors.Wrapf(err, "purging subscriptions of node %s", nodeID)
+	}
+
+	return len(members), nil
+}
+
+// Close stops renewing the leases and removes the node along with the subscriptions it still owns, so they
+// don't linger until the janitor of another node purges them.
+func (rs *redisPubsubService) Close() error {
+	var err error
+	rs.closeOnce.Do(func() {
+		close(rs.quit)
+
+		ctx, cancel := context.WithTimeout(context.Background(), rs.leaseTTL)
+		defer cancel()
+
+		conn, connErr := rs.pool.GetContext(ctx)
+		if connErr != nil {
+			err = errors.Wrap(connErr, "getting redis connection")
+			return
+		}
+		defer conn.Close()
+
+		_, err = rs.purgeNode(ctx, conn, rs.nodeID)
+	})
+
+	return err
+}
+
+// sendSubscribe queues the commands for adding or renewing a single subscription owned by this node.
+func (rs *redisPubsubService) sendSubscribe(conn redis.Conn, expiry int64, connectionID, topic string) error {
+	if err := conn.Send("ZADD", redisSubscriptionsKeyPrefix+topic, expiry, connectionID); err != nil {
+		return err
+	}
+
+	return conn.Send("SADD", rs.nodeSubscriptionsKey(rs.nodeID), subscriptionMember(connectionID, topic))
+}
+
+// leaseExpiry returns the expiry for a lease taken now, in unix milliseconds.
+func (rs *redisPubsubService) leaseExpiry() int64 {
+	return time.Now().Add(rs.leaseTTL).UnixNano() / int64(time.Millisecond)
+}
+
+func (rs *redisPubsubService) nodeSubscriptionsKey(nodeID string) string {
+	return fmt.Sprintf(redisNodeSubscriptionsKeyFmt, nodeID)
+}
+
+// subscriptionMember encodes a subscription as connectionID:topic. Connection ids never contain a colon, so the
+// first colon always separates the two.
+func subscriptionMember(connectionID, topic string) string {
+	return connectionID + ":" + topic
+}
+
+func parseSubscriptionMember(member string) (connectionID, topic string) {
+	parts := strings.SplitN(member, ":", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// NewRedisPubsubService returns an new instance of redis pubsub service. The subscriptions made through the service
+// are owned by the node with the given id and leased for leaseTTL, the leases are renewed in the background as long
+// as the node is alive. Subscriptions of nodes that stop renewing their leases are purged.
+func NewRedisPubsubService(pool *redis.Pool, nodeID string, leaseTTL time.Duration, logger *slog.Logger) Service {
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+
+	rs := &redisPubsubService{
+		pool:          pool,
+		nodeID:        nodeID,
+		leaseTTL:      leaseTTL,
+		logger:        loggerOrDefault(logger).With("node", nodeID),
+		subscriptions: make(map[string]map[string]struct{}),
+		quit:          make(chan struct{}),
+	}
+
+	go rs.heartbeat()
+	go rs.janitor()
+
+	return rs
+}
+
+type redisSubscriber struct {
+	pool                *redis.Pool
+	healthCheckInterval time.Duration
+	logger              *slog.Logger
+
+	mu         sync.Mutex
+	pubsubConn *redis.PubSubConn // pubsubConn is the current subscription connection
+	subscribed bool              // subscribed is set while redis confirms the subscription of the current connection
+	closed     bool
+	quit       chan struct{} // quit is closed when the subscriber is closed
+}
+
+// ReceiveEvents keeps a subscription to the hub channel open. Whenever the subscription connection fails, a new
+// connection is taken from the pool and the subscription is restored after a backoff, so the delivery only pauses
+// while redis is unreachable.
+func (rs *redisSubscriber) ReceiveEvents(handler func(evt *messagerooms.PublishEvent)) error {
+	backoff := minReconnectBackoff
+	for {
+		subscribed, err := rs.receive(handler)
+		if rs.isClosed() {
+			return ErrSubscriberClosed
+		}
+
+		rs.logger.Warn("hub subscription failed, reconnecting", "err", err, "backoff", backoff)
+		if subscribed {
+			backoff = minReconnectBackoff
+		}
+
+		select {
+		case <-rs.quit:
+			return ErrSubscriberClosed
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// Close unsubscribes the current subscription connection, which makes ReceiveEvents return once redis confirms it.
+func (rs *redisSubscriber) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.closed {
+		return nil
+	}
+
+	rs.closed = true
+	close(rs.quit)
+
+	if rs.pubsubConn != nil {
+		return rs.pubsubConn.Unsubscribe()
+	}
+
+	return nil
+}
+
+// HealthCheck reports whether the subscription to the hub channel is up. The subscription connection is pinged in the
+// background, so a dead connection is noticed within twice the health check interval.
+func (rs *redisSubscriber) HealthCheck(ctx context.Context) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if rs.closed {
+		return ErrSubscriberClosed
+	}
+
+	if !rs.subscribed {
+		return ErrNotSubscribed
+	}
+
+	return nil
+}
+
+func (rs *redisSubscriber) isClosed() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.closed
+}
+
+// receive subscribes a single connection to the hub channel and delivers the events received over it until the
+// connection fails. It reports whether the subscription was established.
+func (rs *redisSubscriber) receive(handler func(evt *messagerooms.PublishEvent)) (bool, error) {
+	conn := rs.pool.Get()
+	if err := conn.Err(); err != nil {
+		return false, err
+	}
+
+	pubsubConn := &redis.PubSubConn{Conn: conn}
+	defer pubsubConn.Close()
+
+	// every event published by the redis pubsub service lands in the hub channel. Commands on the connection are
+	// sent holding the lock, as redis connections support only one concurrent sender.
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		return false, ErrSubscriberClosed
+	}
+
+	if err := pubsubConn.Subscribe(messagerooms.HubChannel); err != nil {
+		rs.mu.Unlock()
+		return false, err
+	}
+	rs.pubsubConn = pubsubConn
+	rs.mu.Unlock()
+
+	defer func() {
+		rs.mu.Lock()
+		rs.pubsubConn = nil
+		rs.subscribed = false
+		rs.mu.Unlock()
+	}()
+
+	// the connection is pinged periodically, if neither the pong nor any other message arrives in twice the
+	// interval the connection is considered dead.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(rs.healthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				rs.mu.Lock()
+				err := pubsubConn.Ping("")
+				rs.mu.Unlock()
+
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	subscribed := false
+	for {
+		switch v := pubsubConn.ReceiveWithTimeout(2 * rs.healthCheckInterval).(type) {
+		case redis.Message:
+			// We expect that data should be of type PublishEvent. Otherwise its an error and we don't process it.
+			var eventMessage *messagerooms.PublishEvent
+			if err := json.Unmarshal(v.Data, &eventMessage); err != nil {
+				rs.logger.Warn("invalid event received", "channel", v.Channel, "err", err)
+				break
+			}
+
+			rs.logger.Debug("event received", "channel", v.Channel, "topic", eventMessage.Topic,
+				"connection_id", eventMessage.ConnectionID, "request_id", eventMessage.RequestID)
+			handler(eventMessage)
+		case redis.Subscription:
+			rs.logger.Info("hub subscription changed", "channel", v.Channel, "kind", v.Kind, "count", v.Count)
+
+			// the subscription only ends when the subscriber is closed.
+			if v.Count == 0 {
+				return subscribed, ErrSubscriberClosed
+			}
+			subscribed = true
+
+			rs.mu.Lock()
+			rs.subscribed = true
+			rs.mu.Unlock()
+		case redis.Pong:
+		case error:
+			return subscribed, v
+		}
+	}
+}
+
+// NewRedisSubscriber returns a Subscriber that receives events from the redis hub channel. It holds one
+// connection of the pool for the subscription, which is pinged every healthCheckInterval.
+func NewRedisSubscriber(pool *redis.Pool, healthCheckInterval time.Duration, logger *slog.Logger) Subscriber {
+	if healthCheckInterval <= 0 {
+		healthCheckInterval = defaultHealthCheckInterval
+	}
+
+	return &redisSubscriber{
+		pool:                pool,
+		healthCheckInterval: healthCheckInterval,
+		logger:              loggerOrDefault(logger),
+		quit:                make(chan struct{}),
+	}
+}
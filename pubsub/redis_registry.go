@@ -0,0 +1,278 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/iamsayantan/messagerooms"
+	"github.com/pkg/errors"
+)
+
+// Redis keys used by the connection registry. The connections of a user are kept in a sorted set scored by their
+// lease expiry, and their details in a hash keyed by the connection id.
+const (
+	redisConnectionsKeyPrefix    = "connections:"
+	redisConnectionInfoKeyPrefix = "connection-info:"
+)
+
+// redisConnectionRegistry registers the connections in redis. Like the subscriptions, the registrations are leased
+// and renewed by the node owning the connections, so the connections of a dead node fall out of the registry once
+// their leases expire.
+type redisConnectionRegistry struct {
+	pool     *redis.Pool
+	leaseTTL time.Duration
+	logger   *slog.Logger
+
+	mu          sync.Mutex
+	connections map[string]messagerooms.ConnectionInfo // connections registered by this node keyed by connection id
+
+	quit      chan struct{} // quit is closed to stop renewing the leases
+	closeOnce sync.Once
+}
+
+func (rr *redisConnectionRegistry) Register(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	conn, err := rr.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return errors.Wrap(err, "registering connection "+info.ConnectionID)
+	}
+
+	if err := rr.sendRegister(conn, rr.leaseExpiry(), info); err != nil {
+		return errors.Wrap(err, "registering connection "+info.ConnectionID)
+	}
+
+	if _, err := redis.DoContext(conn, ctx, "EXEC"); err != nil {
+		return errors.Wrap(err, "registering connection "+info.ConnectionID)
+	}
+
+	rr.mu.Lock()
+	rr.connections[info.ConnectionID] = info
+	rr.mu.Unlock()
+
+	return nil
+}
+
+func (rr *redisConnectionRegistry) Deregister(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	rr.mu.Lock()
+	delete(rr.connections, info.ConnectionID)
+	rr.mu.Unlock()
+
+	conn, err := rr.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	if err := rr.removeConnections(ctx, conn, info.UserID, info.ConnectionID); err != nil {
+		return errors.Wrap(err, "deregistering connection "+info.ConnectionID)
+	}
+
+	return nil
+}
+
+func (rr *redisConnectionRegistry) UserConnections(ctx context.Context, userID string) ([]messagerooms.ConnectionInfo, error) {
+	conn, err := rr.pool.GetContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	// the connections whose lease has expired belonged to a dead node, they are cleaned up along the way.
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	expired, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", redisConnectionsKeyPrefix+userID, "-inf", now))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching expired connections of user %s", userID)
+	}
+
+	if len(expired) > 0 {
+		if err := rr.removeConnections(ctx, conn, userID, expired...); err != nil {
+			rr.logger.Error("removing expired connections", "user_id", userID, "err", err)
+		}
+	}
+
+	connIDs, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", redisConnectionsKeyPrefix+userID, now, "+inf"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching connections of user %s", userID)
+	}
+
+	if len(connIDs) == 0 {
+		return nil, nil
+	}
+
+	args := redis.Args{}.Add(redisConnectionInfoKeyPrefix + userID).AddFlat(connIDs)
+	values, err := redis.ByteSlices(redis.DoContext(conn, ctx, "HMGET", args...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching connection details of user %s", userID)
+	}
+
+	connections := make([]messagerooms.ConnectionInfo, 0, len(values))
+	for i, value := range values {
+		// the connection was deregistered between the two reads.
+		if value == nil {
+			continue
+		}
+
+		var info messagerooms.ConnectionInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			rr.logger.Warn("invalid connection details", "connection_id", connIDs[i], "err", err)
+			continue
+		}
+
+		connections = append(connections, info)
+	}
+
+	return connections, nil
+}
+
+// renew periodically renews the leases of the connections registered by this node.
+func (rr *redisConnectionRegistry) renew() {
+	interval := rr.leaseTTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rr.quit:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := rr.renewLeases(ctx); err != nil {
+				rr.logger.Error("renewing connection leases", "err", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (rr *redisConnectionRegistry) renewLeases(ctx context.Context) error {
+	rr.mu.Lock()
+	connections := make([]messagerooms.ConnectionInfo, 0, len(rr.connections))
+	for _, info := range rr.connections {
+		connections = append(connections, info)
+	}
+	rr.mu.Unlock()
+
+	if len(connections) == 0 {
+		return nil
+	}
+
+	conn, err := rr.pool.GetContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting redis connection")
+	}
+	defer conn.Close()
+
+	expiry := rr.leaseExpiry()
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+
+	for _, info := range connections {
+		if err := rr.sendRegister(conn, expiry, info); err != nil {
+			return err
+		}
+	}
+
+	_, err = redis.DoContext(conn, ctx, "EXEC")
+	return err
+}
+
+// Close stops renewing the leases and removes the connections this node still has registered.
+func (rr *redisConnectionRegistry) Close() error {
+	var err error
+	rr.closeOnce.Do(func() {
+		close(rr.quit)
+
+		rr.mu.Lock()
+		connections := rr.connections
+		rr.connections = make(map[string]messagerooms.ConnectionInfo)
+		rr.mu.Unlock()
+
+		if len(connections) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), rr.leaseTTL)
+		defer cancel()
+
+		conn, connErr := rr.pool.GetContext(ctx)
+		if connErr != nil {
+			err = errors.Wrap(connErr, "getting redis connection")
+			return
+		}
+		defer conn.Close()
+
+		for connID, info := range connections {
+			if removeErr := rr.removeConnections(ctx, conn, info.UserID, connID); removeErr != nil && err == nil {
+				err = errors.Wrap(removeErr, "deregistering connection "+connID)
+			}
+		}
+	})
+
+	return err
+}
+
+// sendRegister queues the commands for adding or renewing a single connection.
+func (rr *redisConnectionRegistry) sendRegister(conn redis.Conn, expiry int64, info messagerooms.ConnectionInfo) error {
+	details, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Send("ZADD", redisConnectionsKeyPrefix+info.UserID, expiry, info.ConnectionID); err != nil {
+		return err
+	}
+
+	return conn.Send("HSET", redisConnectionInfoKeyPrefix+info.UserID, info.ConnectionID, details)
+}
+
+// removeConnections removes the connections of the user in a single transaction.
+func (rr *redisConnectionRegistry) removeConnections(ctx context.Context, conn redis.Conn, userID string, connIDs ...string) error {
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+
+	if err := conn.Send("ZREM", redis.Args{}.Add(redisConnectionsKeyPrefix+userID).AddFlat(connIDs)...); err != nil {
+		return err
+	}
+
+	if err := conn.Send("HDEL", redis.Args{}.Add(redisConnectionInfoKeyPrefix+userID).AddFlat(connIDs)...); err != nil {
+		return err
+	}
+
+	_, err := redis.DoContext(conn, ctx, "EXEC")
+	return err
+}
+
+// leaseExpiry returns the expiry for a lease taken now, in unix milliseconds.
+func (rr *redisConnectionRegistry) leaseExpiry() int64 {
+	return time.Now().Add(rr.leaseTTL).UnixNano() / int64(time.Millisecond)
+}
+
+// NewRedisConnectionRegistry returns the redis implementation of the ConnectionRegistry. The registrations are
+// leased for leaseTTL and renewed in the background as long as the node is alive.
+func NewRedisConnectionRegistry(pool *redis.Pool, leaseTTL time.Duration, logger *slog.Logger) ConnectionRegistry {
+	if leaseTTL <= 0 {
+		leaseTTL = defaultLeaseTTL
+	}
+
+	rr := &redisConnectionRegistry{
+		pool:        pool,
+		leaseTTL:    leaseTTL,
+		logger:      loggerOrDefault(logger),
+		connections: make(map[string]messagerooms.ConnectionInfo),
+		quit:        make(chan struct{}),
+	}
+
+	go rr.renew()
+
+	return rr
+}
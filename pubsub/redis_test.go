@@ -0,0 +1,160 @@
+package pubsub
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/iamsayantan/messagerooms"
+)
+
+func runRedis(t *testing.T) (*miniredis.Miniredis, *redis.Pool) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	pool := NewRedisPool(RedisConfig{Addr: mr.Addr(), MaxIdle: 2})
+	t.Cleanup(func() { _ = pool.Close() })
+
+	return mr, pool
+}
+
+// newRedisNode returns the pubsub service of a node that never renews its leases, like a node that died right after
+// subscribing its connections.
+func newRedisNode(pool *redis.Pool, nodeID string, leaseTTL time.Duration) *redisPubsubService {
+	return &redisPubsubService{
+		pool:          pool,
+		nodeID:        nodeID,
+		leaseTTL:      leaseTTL,
+		logger:        loggerOrDefault(nil),
+		subscriptions: make(map[string]map[string]struct{}),
+		quit:          make(chan struct{}),
+	}
+}
+
+// eventually retries the condition until it holds or a second passes.
+func eventually(t *testing.T, condition func() bool, format string, args ...interface{}) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisPublishSkipsExpiredLeases(t *testing.T) {
+	mr, pool := runRedis(t)
+	user := messagerooms.User{ID: "user-1"}
+	room := messagerooms.Room{ID: "room-1", RoomName: "room", UserID: user.ID}
+	created := &messagerooms.RoomCreatedEvent{Room: room}
+	topic := redisSubscriptionsKeyPrefix + created.GetTopic()
+
+	live := NewRedisPubsubService(pool, "live", time.Minute, nil)
+	t.Cleanup(func() { _ = live.Close() })
+
+	dead := newRedisNode(pool, "dead", 50*time.Millisecond)
+	if err := dead.Subscribe(t.Context(), "dead-conn", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("subscribing connection of the dead node: %v", err)
+	}
+
+	if err := live.Subscribe(t.Context(), "live-conn", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("subscribing connection of the live node: %v", err)
+	}
+
+	sub := NewRedisSubscriber(pool, time.Minute, nil)
+	t.Cleanup(func() { _ = sub.Close() })
+	received := receive(sub)
+	eventually(t, func() bool { return sub.HealthCheck(t.Context()) == nil }, "subscriber is not subscribed")
+
+	// the lease of the dead node's connection expires, it is neither delivered to nor kept once published to.
+	time.Sleep(100 * time.Millisecond)
+	if err := live.Publish(t.Context(), created); err != nil {
+		t.Fatalf("publishing event: %v", err)
+	}
+
+	if evt := expectEvent(t, received); evt.ConnectionID != "live-conn" {
+		t.Errorf("event delivered to %q, want live-conn", evt.ConnectionID)
+	}
+
+	members, err := mr.ZMembers(topic)
+	if err != nil {
+		t.Fatalf("listing subscribers: %v", err)
+	}
+
+	if !reflect.DeepEqual(members, []string{"live-conn"}) {
+		t.Errorf("subscribers after publishing = %v, want [live-conn]", members)
+	}
+}
+
+func TestRedisPurgesDeadNodes(t *testing.T) {
+	mr, pool := runRedis(t)
+	user := messagerooms.User{ID: "user-1"}
+	topic := redisSubscriptionsKeyPrefix + user.GetPersonalTopics()[0]
+
+	dead := newRedisNode(pool, "dead", 50*time.Millisecond)
+	if err := dead.Subscribe(t.Context(), "dead-conn", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("subscribing connection of the dead node: %v", err)
+	}
+
+	// the live node renews its leases, while its janitor purges the dead node.
+	live := NewRedisPubsubService(pool, "live", 50*time.Millisecond, nil)
+	t.Cleanup(func() { _ = live.Close() })
+
+	if err := live.Subscribe(t.Context(), "live-conn", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("subscribing connection of the live node: %v", err)
+	}
+
+	deadKey := fmt.Sprintf(redisNodeSubscriptionsKeyFmt, "dead")
+	eventually(t, func() bool { return !mr.Exists(deadKey) }, "subscriptions of the dead node are not purged")
+
+	members, err := mr.ZMembers(topic)
+	if err != nil {
+		t.Fatalf("listing subscribers: %v", err)
+	}
+
+	if !reflect.DeepEqual(members, []string{"live-conn"}) {
+		t.Errorf("subscribers after purging = %v, want [live-conn]", members)
+	}
+
+	nodes, err := mr.ZMembers(redisNodesKey)
+	if err != nil {
+		t.Fatalf("listing nodes: %v", err)
+	}
+
+	if !reflect.DeepEqual(nodes, []string{"live"}) {
+		t.Errorf("nodes after purging = %v, want [live]", nodes)
+	}
+}
+
+func TestRedisRenewDoesNotRestoreUnsubscribed(t *testing.T) {
+	mr, pool := runRedis(t)
+	user := messagerooms.User{ID: "user-1"}
+	topic := redisSubscriptionsKeyPrefix + user.GetPersonalTopics()[0]
+
+	node := newRedisNode(pool, "node", time.Minute)
+	if err := node.Subscribe(t.Context(), "conn-1", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("subscribing connection: %v", err)
+	}
+
+	if err := node.Unsubscribe(t.Context(), "conn-1", user.GetPersonalTopics()...); err != nil {
+		t.Fatalf("unsubscribing connection: %v", err)
+	}
+
+	if err := node.renewLeases(t.Context()); err != nil {
+		t.Fatalf("renewing leases: %v", err)
+	}
+
+	if mr.Exists(topic) {
+		members, _ := mr.ZMembers(topic)
+		t.Errorf("subscribers after renewing = %v, want none", members)
+	}
+
+	if mr.Exists(node.nodeSubscriptionsKey("node")) {
+		t.Error("subscriptions of the node are still recorded after renewing")
+	}
+}
@@ -1,62 +1,77 @@
 package pubsub
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/iamsayantan/messagerooms"
 )
 
+var (
+	// ErrSubscriberClosed is returned by ReceiveEvents after the subscriber is closed.
+	ErrSubscriberClosed = errors.New("subscriber closed")
+
+	// ErrNotSubscribed is returned by the health check of a subscriber whose subscription is down.
+	ErrNotSubscribed = errors.New("not subscribed to the hub events")
+)
+
 // Service interface defines methods for interacting with the pubsub system.
 type Service interface {
-	Publish(data messagerooms.Publishable)
+	// Publish prepares an event for every connection subscribed to the data's topic and publishes them into the
+	// pubsub system. An error is returned if the event could not be handed over to the pubsub system.
+	Publish(ctx context.Context, data messagerooms.Publishable) error
 
-	// Subscribe adds the given connection id to the topic's subscribed connection list. During publish
+	// Subscribe adds the given connection id to each of the topic's subscribed connection list. During publish
 	// we fetch all the connectionIDs and dispatch it to the client.
-	Subscribe(topic, connectionID string)
-	Unsubscribe(topic, connectionID string)
-}
+	Subscribe(ctx context.Context, connectionID string, topics ...string) error
 
-type redisPubsubService struct {
-	redisConn redis.Conn
-}
+	// Unsubscribe removes the given connection id from each of the topic's subscribed connection list.
+	Unsubscribe(ctx context.Context, connectionID string, topics ...string) error
 
-func (rs *redisPubsubService) Subscribe(topic, connectionID string) {
-	_, err := rs.redisConn.Do("LPUSH", topic, connectionID)
-	if err != nil {
-		log.Printf("Error: %s, subscribing to topic: %s, connectionID: %s", err.Error(), topic, connectionID)
-	}
+	// HealthCheck returns an error if the pubsub system can not be reached for publishing.
+	HealthCheck(ctx context.Context) error
+
+	// Close stops the background work of the service and releases the subscriptions still owned by this node.
+	Close() error
 }
 
-func (rs *redisPubsubService) Unsubscribe(topic, connectionID string) {
-	// connection id is stored as a list in redis against the topic name. so to unsubscribe we just need to
-	// do LREM the connection id from the list.
-	_, err := rs.redisConn.Do("LREM", topic, 1, connectionID)
-	if err != nil {
-		log.Printf("Error: %s, unsubscribing to topic: %s, connectionID: %s", err.Error(), topic, connectionID)
-	}
+// Subscriber receives the events published into the pubsub system and hands them over to the hub, which
+// then delivers them to the open connections.
+type Subscriber interface {
+	// ReceiveEvents blocks and calls the handler for every event that needs to be delivered from this node.
+	// It returns when the underlying subscription fails and can not be recovered, or the subscriber is closed.
+	ReceiveEvents(handler func(evt *messagerooms.PublishEvent)) error
+
+	// HealthCheck returns an error while the subscriber is not receiving events, like when it is reconnecting.
+	HealthCheck(ctx context.Context) error
+
+	// Close stops receiving events, ReceiveEvents returns ErrSubscriberClosed.
+	Close() error
 }
 
-func (rs *redisPubsubService) Publish(data messagerooms.Publishable) {
-	// for publishing data we find all the connection id that is subscribed to the given topic and prepare
-	// event for all of those connection ids and publish
-	topic := data.GetTopic()
-	connIDs, err := redis.Strings(rs.redisConn.Do("LRANGE", topic, 0, -1))
-	if err != nil {
-		log.Printf("Error: %s, fetching topic: %s, ", err.Error(), topic)
-	}
+// ConnectionRegistry keeps track of the eventsource connections open on all the nodes, so that a user's connections
+// can be counted and listed regardless of the node they are open on.
+type ConnectionRegistry interface {
+	// Register records a connection opened on this node. It stays registered until it is deregistered or the node
+	// goes away.
+	Register(ctx context.Context, info messagerooms.ConnectionInfo) error
 
-	for _, connID := range connIDs {
-		publishEvent := data.ToPublish(connID)
-		jsonEvent, err := publishEvent.ToJSON()
-		if err != nil {
-			return // silently ignoring the error
-		}
-		_, _ = rs.redisConn.Do("PUBLISH", messagerooms.HubChannel, jsonEvent)
-	}
+	// Deregister removes a connection of this node from the registry.
+	Deregister(ctx context.Context, info messagerooms.ConnectionInfo) error
+
+	// UserConnections returns the connections of the user open on any node.
+	UserConnections(ctx context.Context, userID string) ([]messagerooms.ConnectionInfo, error)
+
+	// Close stops the background work of the registry and removes the connections still registered by this node.
+	Close() error
 }
 
-// NewRedisPubsubService returns an new instance of redis pubsub service
-func NewRedisPubsubService(conn redis.Conn) Service {
-	return &redisPubsubService{redisConn: conn}
+// loggerOrDefault returns the logger, or the default logger if it is nil.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+
+	return logger
 }
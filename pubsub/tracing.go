@@ -0,0 +1,89 @@
+package pubsub
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingService struct {
+	tracer trace.Tracer
+	next   Service
+}
+
+func (s *tracingService) Publish(ctx context.Context, data messagerooms.Publishable) (err error) {
+	ctx, span := s.tracer.Start(ctx, "pubsub.Publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", data.GetTopic()),
+			attribute.String("messaging.message.event", string(data.GetEvent())),
+		),
+	)
+	defer func() { endSpan(span, err) }()
+
+	return s.next.Publish(ctx, data)
+}
+
+func (s *tracingService) Subscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "pubsub.Subscribe", trace.WithAttributes(
+		attribute.String("connection_id", connectionID),
+		attribute.StringSlice("topics", topics),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.Subscribe(ctx, connectionID, topics...)
+}
+
+func (s *tracingService) Unsubscribe(ctx context.Context, connectionID string, topics ...string) (err error) {
+	ctx, span := s.tracer.Start(ctx, "pubsub.Unsubscribe", trace.WithAttributes(
+		attribute.String("connection_id", connectionID),
+		attribute.StringSlice("topics", topics),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.Unsubscribe(ctx, connectionID, topics...)
+}
+
+// HealthCheck is not traced, the probes would bury the traces of the requests.
+func (s *tracingService) HealthCheck(ctx context.Context) error {
+	return s.next.HealthCheck(ctx)
+}
+
+func (s *tracingService) Close() error {
+	return s.next.Close()
+}
+
+// NewTracingService returns an instance of a tracing Service. The published events carry the trace context of the
+// publish span, the hub continues the trace when it delivers them.
+func NewTracingService(tracer trace.Tracer, s Service) Service {
+	return &tracingService{
+		tracer: tracer,
+		next:   s,
+	}
+}
+
+// endSpan records the error of the traced call, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTraceContext returns the trace context of ctx to be carried by the published events, or nil if ctx is not
+// part of a trace.
+func injectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
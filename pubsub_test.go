@@ -0,0 +1,98 @@
+package messagerooms
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublishEventOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     OverflowPolicy
+		queued     []EventMessage
+		published  EventMessage
+		wantErr    error
+		wantQueue  []ServerEvent
+		wantSeq    []int64
+		disconnect bool
+	}{
+		{
+			name:      "drop oldest",
+			policy:    OverflowDropOldest,
+			queued:    []EventMessage{{Event: "first"}, {Event: "second"}},
+			published: EventMessage{Event: "third"},
+			wantErr:   ErrEventDropped,
+			wantQueue: []ServerEvent{"second", "third"},
+			wantSeq:   []int64{2, 3},
+		},
+		{
+			name:       "disconnect",
+			policy:     OverflowDisconnect,
+			queued:     []EventMessage{{Event: "first"}, {Event: "second"}},
+			published:  EventMessage{Event: "third"},
+			wantErr:    ErrConnectionOverflow,
+			disconnect: true,
+		},
+		{
+			name:      "coalesce with a queued event",
+			policy:    OverflowCoalesce,
+			queued:    []EventMessage{{Event: "first", CoalesceKey: "typing"}, {Event: "second"}},
+			published: EventMessage{Event: "third", CoalesceKey: "typing"},
+			wantErr:   ErrEventCoalesced,
+			wantQueue: []ServerEvent{"third", "second"},
+			wantSeq:   []int64{1, 2},
+		},
+		{
+			name:      "coalesce without a queued event drops the oldest",
+			policy:    OverflowCoalesce,
+			queued:    []EventMessage{{Event: "first", CoalesceKey: "typing"}, {Event: "second"}},
+			published: EventMessage{Event: "third", CoalesceKey: "presence"},
+			wantErr:   ErrEventDropped,
+			wantQueue: []ServerEvent{"second", "third"},
+			wantSeq:   []int64{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := NewEventsourceConnection(&User{ID: "alice"}, 2, tt.policy)
+			for _, evt := range tt.queued {
+				if err := conn.PublishEvent(evt); err != nil {
+					t.Fatalf("queueing %q: %v", evt.Event, err)
+				}
+			}
+
+			if err := conn.PublishEvent(tt.published); err != tt.wantErr {
+				t.Errorf("PublishEvent() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var queue []ServerEvent
+			var sequences []int64
+			for _, evt := range conn.Drain() {
+				queue = append(queue, evt.Event)
+				sequences = append(sequences, evt.Sequence)
+			}
+
+			if !reflect.DeepEqual(queue, tt.wantQueue) || !reflect.DeepEqual(sequences, tt.wantSeq) {
+				t.Errorf("queue = %v %v, want %v %v", queue, sequences, tt.wantQueue, tt.wantSeq)
+			}
+
+			select {
+			case <-conn.Done():
+				if !tt.disconnect {
+					t.Errorf("connection disconnected with %v", conn.Err())
+				}
+			default:
+				if tt.disconnect {
+					t.Error("connection is not disconnected")
+				}
+			}
+
+			if tt.disconnect {
+				if err := conn.PublishEvent(EventMessage{Event: "fourth"}); err != ErrConnectionOverflow {
+					t.Errorf("PublishEvent() after disconnecting error = %v, want %v", err, ErrConnectionOverflow)
+				}
+			}
+		})
+	}
+}
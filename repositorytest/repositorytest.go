@@ -0,0 +1,714 @@
+// Package repositorytest provides a test suite verifying that an implementation of the repositories behaves like
+// the others. The storage packages run it against their own repositories.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Repositories are the repositories under test, backed by the same storage along with its unit of work.
+type Repositories struct {
+	Users      messagerooms.UserRepository
+	Rooms      messagerooms.RoomRepository
+	Messages   messagerooms.MessageRepository
+	UnitOfWork messagerooms.UnitOfWork
+}
+
+// Run runs the suite against the repositories returned by newRepositories, which is called for every test. The
+// tests create their own users and rooms with unique names, so the storage does not need to be empty.
+func Run(t *testing.T, newRepositories func(t *testing.T) Repositories) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepositories(t)) })
+	t.Run("Rooms", func(t *testing.T) { testRooms(t, newRepositories(t)) })
+	t.Run("RoomMembers", func(t *testing.T) { testRoomMembers(t, newRepositories(t)) })
+	t.Run("ListRoomMembers", func(t *testing.T) { testListRoomMembers(t, newRepositories(t)) })
+	t.Run("Messages", func(t *testing.T) { testMessages(t, newRepositories(t)) })
+	t.Run("RoomActivity", func(t *testing.T) { testRoomActivity(t, newRepositories(t)) })
+	t.Run("ListRooms", func(t *testing.T) { testListRooms(t, newRepositories(t)) })
+	t.Run("UnitOfWork", func(t *testing.T) { testUnitOfWork(t, newRepositories(t)) })
+	t.Run("Cancelled", func(t *testing.T) { testCancelled(t, newRepositories(t)) })
+}
+
+func testUsers(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	nickname := uniqueName("user")
+	created, err := repos.Users.Create(ctx, nickname, "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	if created.ID == "" || created.Nickname != nickname {
+		t.Fatalf("created user = %+v, want an id and nickname %s", created, nickname)
+	}
+
+	byID, err := repos.Users.FindByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("finding user by id: %v", err)
+	}
+
+	if byID.Nickname != nickname || byID.Password != "secret" {
+		t.Errorf("user found by id = %+v, want nickname %s and its password", byID, nickname)
+	}
+
+	byNickname, err := repos.Users.FindByNickname(ctx, nickname)
+	if err != nil {
+		t.Fatalf("finding user by nickname: %v", err)
+	}
+
+	if byNickname.ID != created.ID {
+		t.Errorf("user found by nickname has id %s, want %s", byNickname.ID, created.ID)
+	}
+
+	if _, err := repos.Users.Create(ctx, nickname, "other"); !errors.Is(err, messagerooms.ErrConflict) {
+		t.Errorf("creating a user with a taken nickname: err = %v, want %v", err, messagerooms.ErrConflict)
+	}
+
+	if _, err := repos.Users.FindByID(ctx, uuid.NewV4().String()); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("finding an unknown user by id: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	renamed := *byID
+	renamed.Nickname = uniqueName("renamed")
+	if err := repos.Users.Update(ctx, renamed); err != nil {
+		t.Fatalf("updating user: %v", err)
+	}
+
+	if updated, err := repos.Users.FindByID(ctx, created.ID); err != nil || updated.Nickname != renamed.Nickname {
+		t.Errorf("user found after updating = %+v, %v, want nickname %s", updated, err, renamed.Nickname)
+	}
+
+	// updating with the same values is not mistaken for a missing user.
+	if err := repos.Users.Update(ctx, renamed); err != nil {
+		t.Errorf("updating user without changes: %v", err)
+	}
+
+	other := createUser(t, repos)
+	other.Nickname = renamed.Nickname
+	if err := repos.Users.Update(ctx, *other); !errors.Is(err, messagerooms.ErrConflict) {
+		t.Errorf("updating a user with a taken nickname: err = %v, want %v", err, messagerooms.ErrConflict)
+	}
+
+	if err := repos.Users.Update(ctx, messagerooms.User{ID: uuid.NewV4().String(), Nickname: uniqueName("ghost")}); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("updating an unknown user: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	if _, err := repos.Users.FindByNickname(ctx, uniqueName("unknown")); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("finding an unknown user by nickname: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+}
+
+func testRooms(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+
+	name := uniqueName("room")
+	created, err := repos.Rooms.Create(ctx, name, *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	if created.ID == "" || created.RoomName != name {
+		t.Fatalf("created room = %+v, want an id and name %s", created, name)
+	}
+
+	found, err := repos.Rooms.Find(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.RoomName != name {
+		t.Errorf("found room name = %s, want %s", found.RoomName, name)
+	}
+
+	if found.CreatedBy == nil || found.CreatedBy.ID != owner.ID {
+		t.Errorf("found room created by %+v, want user %s", found.CreatedBy, owner.ID)
+	}
+
+	if _, err := repos.Rooms.Find(ctx, uuid.NewV4().String()); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("finding an unknown room: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	looked, err := repos.Rooms.Lookup(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("looking room up: %v", err)
+	}
+
+	if looked.RoomName != name || looked.UserID != owner.ID {
+		t.Errorf("looked up room = %+v, want %s owned by %s", looked, name, owner.ID)
+	}
+
+	if _, err := repos.Rooms.Lookup(ctx, uuid.NewV4().String()); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("looking an unknown room up: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	all, err := repos.Rooms.FindAll(ctx, messagerooms.RoomQuery{})
+	if err != nil {
+		t.Fatalf("finding all rooms: %v", err)
+	}
+
+	var listed *messagerooms.Room
+	for _, room := range all {
+		if room.ID == created.ID {
+			listed = room
+		}
+	}
+
+	if listed == nil {
+		t.Fatalf("room %s is not listed", created.ID)
+	}
+
+	if listed.CreatedBy == nil || listed.CreatedBy.ID != owner.ID {
+		t.Errorf("listed room created by %+v, want user %s", listed.CreatedBy, owner.ID)
+	}
+}
+
+func testRoomMembers(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+	member := createUser(t, repos)
+	outsider := createUser(t, repos)
+	room := createRoom(t, repos, owner)
+	otherRoom := createRoom(t, repos, owner)
+
+	members, err := repos.Rooms.GetRoomMembers(ctx, *room)
+	if err != nil {
+		t.Fatalf("getting room members: %v", err)
+	}
+
+	if len(members) != 0 {
+		t.Errorf("members of a new room = %+v, want none", members)
+	}
+
+	if err := repos.Rooms.AddUserToRoom(ctx, *room, *member); err != nil {
+		t.Fatalf("adding user to room: %v", err)
+	}
+
+	if !isMember(t, repos, room, member) {
+		t.Error("member is not found in the room")
+	}
+
+	if isMember(t, repos, room, outsider) {
+		t.Error("user who did not join is found in the room")
+	}
+
+	if isMember(t, repos, otherRoom, member) {
+		t.Error("member is found in a room they did not join")
+	}
+
+	if err := repos.Rooms.AddUserToRoom(ctx, *room, *member); !errors.Is(err, messagerooms.ErrConflict) {
+		t.Errorf("adding a member to the room again: err = %v, want %v", err, messagerooms.ErrConflict)
+	}
+
+	members, err = repos.Rooms.GetRoomMembers(ctx, *room)
+	if err != nil {
+		t.Fatalf("getting room members: %v", err)
+	}
+
+	if len(members) != 1 || members[0].ID != member.ID {
+		t.Errorf("room members = %+v, want only user %s", members, member.ID)
+	}
+
+	found, err := repos.Rooms.Find(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.MemberCount != 1 {
+		t.Errorf("found room member count = %d, want 1", found.MemberCount)
+	}
+
+	all, err := repos.Rooms.FindAll(ctx, messagerooms.RoomQuery{})
+	if err != nil {
+		t.Fatalf("finding all rooms: %v", err)
+	}
+
+	for _, listed := range all {
+		if listed.ID == room.ID && listed.MemberCount != 1 {
+			t.Errorf("listed room member count = %d, want 1", listed.MemberCount)
+		}
+	}
+}
+
+func testListRoomMembers(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+	room := createRoom(t, repos, owner)
+
+	// the members are created out of the order of their nicknames, which the pages follow.
+	prefix := uniqueName("member")
+	for _, suffix := range []string{"c", "a", "d", "b", "e"} {
+		user, err := repos.Users.Create(ctx, prefix+"-"+suffix, "secret")
+		if err != nil {
+			t.Fatalf("creating user: %v", err)
+		}
+
+		if err := repos.Rooms.AddUserToRoom(ctx, *room, *user); err != nil {
+			t.Fatalf("adding user to room: %v", err)
+		}
+	}
+
+	var after string
+	for _, want := range [][]string{{"a", "b"}, {"c", "d"}, {"e"}} {
+		page, err := repos.Rooms.ListRoomMembers(ctx, *room, after, 2)
+		if err != nil {
+			t.Fatalf("listing room members: %v", err)
+		}
+
+		var got []string
+		for _, user := range page {
+			got = append(got, user.Nickname)
+		}
+
+		var nicknames []string
+		for _, suffix := range want {
+			nicknames = append(nicknames, prefix+"-"+suffix)
+		}
+
+		if !slices.Equal(got, nicknames) {
+			t.Fatalf("room members after %q = %v, want %v", after, got, nicknames)
+		}
+
+		after = got[len(got)-1]
+	}
+
+	page, err := repos.Rooms.ListRoomMembers(ctx, *room, after, 2)
+	if err != nil {
+		t.Fatalf("listing room members: %v", err)
+	}
+
+	if len(page) != 0 {
+		t.Errorf("room members after the last one = %+v, want none", page)
+	}
+}
+
+func testMessages(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	author := createUser(t, repos)
+	room := createRoom(t, repos, author)
+	otherRoom := createRoom(t, repos, author)
+	emptyRoom := createRoom(t, repos, author)
+
+	first, err := repos.Messages.PostMessage(ctx, *room, *author, "first")
+	if err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	if first.ID == "" || first.MessageText != "first" || first.CreatedAt.IsZero() {
+		t.Fatalf("posted message = %+v, want an id, the text and the creation time", first)
+	}
+
+	if first.CreatedBy == nil || first.CreatedBy.ID != author.ID {
+		t.Errorf("posted message created by %+v, want user %s", first.CreatedBy, author.ID)
+	}
+
+	// the messages are ordered by their creation time, which must differ for the order to be defined.
+	time.Sleep(10 * time.Millisecond)
+	second, err := repos.Messages.PostMessage(ctx, *room, *author, "second")
+	if err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	if _, err := repos.Messages.PostMessage(ctx, *otherRoom, *author, "elsewhere"); err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	found, err := repos.Messages.GetMessage(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("getting message: %v", err)
+	}
+
+	if found.MessageText != "first" || found.RoomID != room.ID || found.UserID != author.ID {
+		t.Errorf("found message = %+v, want the first message", found)
+	}
+
+	if _, err := repos.Messages.GetMessage(ctx, uuid.NewV4().String()); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("getting an unknown message: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	messages, err := repos.Messages.GetMessagesByRoom(ctx, *room)
+	if err != nil {
+		t.Fatalf("getting room messages: %v", err)
+	}
+
+	if len(messages) != 2 || messages[0].ID != second.ID || messages[1].ID != first.ID {
+		t.Fatalf("room messages = %+v, want the second and the first message", messages)
+	}
+
+	if messages[0].CreatedBy == nil || messages[0].CreatedBy.ID != author.ID {
+		t.Errorf("room message created by %+v, want user %s", messages[0].CreatedBy, author.ID)
+	}
+
+	messages, err = repos.Messages.GetMessagesByRoom(ctx, *emptyRoom)
+	if err != nil {
+		t.Fatalf("getting room messages: %v", err)
+	}
+
+	if len(messages) != 0 {
+		t.Errorf("messages of a room without any = %+v, want none", messages)
+	}
+}
+
+func testRoomActivity(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+	room := createRoom(t, repos, owner)
+
+	if room.MessageCount != 0 || room.LastActivityAt != nil {
+		t.Errorf("new room has %d messages and last activity at %v, want none", room.MessageCount, room.LastActivityAt)
+	}
+
+	var last *messagerooms.Message
+	for _, text := range []string{"first", "last"} {
+		last = postMessage(t, repos, room, owner, text, time.Now())
+	}
+
+	found, err := repos.Rooms.Find(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.MessageCount != 2 {
+		t.Errorf("room message count = %d, want 2", found.MessageCount)
+	}
+
+	if found.LastActivityAt == nil || !found.LastActivityAt.Equal(last.CreatedAt) {
+		t.Errorf("room last activity at %v, want %v", found.LastActivityAt, last.CreatedAt)
+	}
+
+	if found.LastMessage == nil || found.LastMessage.ID != last.ID || found.LastMessage.MessageText != "last" {
+		t.Fatalf("room last message = %+v, want message %s", found.LastMessage, last.ID)
+	}
+
+	if found.LastMessage.CreatedBy == nil || found.LastMessage.CreatedBy.ID != owner.ID {
+		t.Errorf("room last message created by %+v, want user %s", found.LastMessage.CreatedBy, owner.ID)
+	}
+
+	unknown := messagerooms.Room{ID: uuid.NewV4().String()}
+	if err := repos.Rooms.RecordMessage(ctx, unknown, *last); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("recording a message of an unknown room: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+}
+
+func testListRooms(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+	member := createUser(t, repos)
+
+	// the rooms are named after a prefix no other room has, and only the rooms of the test are searched. b is named in
+	// upper case, the names are ordered ignoring their case so it comes after a.
+	prefix := uniqueName("Listing")
+	rooms := make(map[string]*messagerooms.Room)
+	for _, suffix := range []string{"c", "a", "b"} {
+		name := prefix + "-" + suffix
+		if suffix == "b" {
+			name = prefix + "-B"
+		}
+
+		room, err := repos.Rooms.Create(ctx, name, *owner)
+		if err != nil {
+			t.Fatalf("creating room: %v", err)
+		}
+
+		if err := repos.Rooms.AddUserToRoom(ctx, *room, *owner); err != nil {
+			t.Fatalf("adding user to room: %v", err)
+		}
+
+		rooms[suffix] = room
+	}
+
+	// a has the most members and no message, c has the latest message.
+	for _, suffix := range []string{"a", "c"} {
+		if err := repos.Rooms.AddUserToRoom(ctx, *rooms[suffix], *member); err != nil {
+			t.Fatalf("adding user to room: %v", err)
+		}
+	}
+
+	if err := repos.Rooms.AddUserToRoom(ctx, *rooms["a"], *createUser(t, repos)); err != nil {
+		t.Fatalf("adding user to room: %v", err)
+	}
+
+	now := time.Now()
+	postMessage(t, repos, rooms["b"], owner, "earlier", now.Add(-2*time.Hour))
+	postMessage(t, repos, rooms["c"], owner, "later", now.Add(-time.Hour))
+
+	tests := []struct {
+		name  string
+		query messagerooms.RoomQuery
+		want  [][]string
+	}{
+		{
+			name:  "by name",
+			query: messagerooms.RoomQuery{Search: strings.ToLower(prefix)},
+			want:  [][]string{{"a", "b"}, {"c"}},
+		},
+		{
+			name:  "by activity",
+			query: messagerooms.RoomQuery{Search: prefix, Sort: messagerooms.SortRoomsByActivity},
+			want:  [][]string{{"c", "b"}, {"a"}},
+		},
+		{
+			name:  "by members",
+			query: messagerooms.RoomQuery{Search: prefix, Sort: messagerooms.SortRoomsByMembers},
+			want:  [][]string{{"a", "c"}, {"b"}},
+		},
+		{
+			name:  "joined",
+			query: messagerooms.RoomQuery{Search: prefix, MemberID: member.ID},
+			want:  [][]string{{"a", "c"}},
+		},
+		{
+			name:  "wildcards",
+			query: messagerooms.RoomQuery{Search: prefix + "-_"},
+			want:  [][]string{{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			query.Limit = 2
+			for _, want := range tt.want {
+				page, err := repos.Rooms.FindAll(ctx, query)
+				if err != nil {
+					t.Fatalf("finding rooms: %v", err)
+				}
+
+				var got []string
+				for _, room := range page {
+					got = append(got, strings.ToLower(strings.TrimPrefix(room.RoomName, prefix+"-")))
+				}
+
+				if !slices.Equal(got, want) {
+					t.Fatalf("rooms after %+v = %v, want %v", query.After, got, want)
+				}
+
+				if len(page) > 0 {
+					query.After = page[len(page)-1]
+				}
+			}
+
+			if len(tt.want[len(tt.want)-1]) < query.Limit {
+				return
+			}
+
+			page, err := repos.Rooms.FindAll(ctx, query)
+			if err != nil {
+				t.Fatalf("finding rooms: %v", err)
+			}
+
+			if len(page) != 0 {
+				t.Errorf("rooms after the last one = %+v, want none", page)
+			}
+		})
+	}
+
+	all, err := repos.Rooms.FindAll(ctx, messagerooms.RoomQuery{Search: prefix})
+	if err != nil {
+		t.Fatalf("finding rooms: %v", err)
+	}
+
+	for _, room := range all {
+		switch {
+		case room.ID == rooms["a"].ID && room.LastMessage != nil:
+			t.Errorf("room without messages has last message %+v", room.LastMessage)
+		case room.ID == rooms["c"].ID && (room.LastMessage == nil || room.LastMessage.MessageText != "later"):
+			t.Errorf("room last message = %+v, want the later message", room.LastMessage)
+		}
+	}
+}
+
+func testUnitOfWork(t *testing.T, repos Repositories) {
+	ctx := t.Context()
+	owner := createUser(t, repos)
+
+	var committed *messagerooms.Room
+	err := repos.UnitOfWork.Do(ctx, func(tx messagerooms.Repositories) error {
+		var err error
+		if committed, err = tx.Rooms.Create(ctx, uniqueName("room"), *owner); err != nil {
+			return err
+		}
+
+		return tx.Rooms.AddUserToRoom(ctx, *committed, *owner)
+	})
+	if err != nil {
+		t.Fatalf("committing unit of work: %v", err)
+	}
+
+	if _, err := repos.Rooms.Find(ctx, committed.ID); err != nil {
+		t.Errorf("finding room created in a committed unit of work: %v", err)
+	}
+
+	if !isMember(t, repos, committed, owner) {
+		t.Error("user added in a committed unit of work is not found in the room")
+	}
+
+	// every change is rolled back when the unit of work fails, the error is returned as it is.
+	failure := errors.New("failure")
+	var rolledBack *messagerooms.Room
+	var message *messagerooms.Message
+	err = repos.UnitOfWork.Do(ctx, func(tx messagerooms.Repositories) error {
+		var err error
+		if rolledBack, err = tx.Rooms.Create(ctx, uniqueName("room"), *owner); err != nil {
+			return err
+		}
+
+		if err := tx.Rooms.AddUserToRoom(ctx, *committed, *createUserIn(t, tx)); err != nil {
+			return err
+		}
+
+		if message, err = tx.Messages.PostMessage(ctx, *committed, *owner, "rolled back"); err != nil {
+			return err
+		}
+
+		if err := tx.Rooms.RecordMessage(ctx, *committed, *message); err != nil {
+			return err
+		}
+
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("rolling back unit of work: err = %v, want %v", err, failure)
+	}
+
+	if _, err := repos.Rooms.Find(ctx, rolledBack.ID); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("finding room created in a rolled back unit of work: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	if _, err := repos.Messages.GetMessage(ctx, message.ID); !errors.Is(err, messagerooms.ErrNotFound) {
+		t.Errorf("getting message posted in a rolled back unit of work: err = %v, want %v", err, messagerooms.ErrNotFound)
+	}
+
+	found, err := repos.Rooms.Find(ctx, committed.ID)
+	if err != nil {
+		t.Fatalf("finding room: %v", err)
+	}
+
+	if found.MemberCount != 1 {
+		t.Errorf("room member count = %d, want only the owner to be a member", found.MemberCount)
+	}
+
+	if found.MessageCount != 0 || found.LastActivityAt != nil {
+		t.Errorf("room has %d messages and last activity at %v, want the activity to be rolled back", found.MessageCount, found.LastActivityAt)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	err = repos.UnitOfWork.Do(cancelled, func(tx messagerooms.Repositories) error {
+		_, err := tx.Rooms.Create(cancelled, uniqueName("room"), *owner)
+		return err
+	})
+	if !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("running a unit of work with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+}
+
+func testCancelled(t *testing.T, repos Repositories) {
+	user := createUser(t, repos)
+	room := createRoom(t, repos, user)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := repos.Users.Create(ctx, uniqueName("user"), "secret"); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("creating a user with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	if _, err := repos.Users.FindByID(ctx, user.ID); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("finding a user with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	if _, err := repos.Rooms.Find(ctx, room.ID); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("finding a room with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	if _, err := repos.Rooms.CheckUserExistsInRoom(ctx, *room, *user); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("checking a member with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	if _, err := repos.Messages.PostMessage(ctx, *room, *user, "cancelled"); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("posting a message with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	messages, err := repos.Messages.GetMessagesByRoom(t.Context(), *room)
+	if err != nil {
+		t.Fatalf("getting room messages: %v", err)
+	}
+
+	if len(messages) != 0 {
+		t.Errorf("room messages = %+v, want none to be posted with a cancelled context", messages)
+	}
+}
+
+func isMember(t *testing.T, repos Repositories, room *messagerooms.Room, user *messagerooms.User) bool {
+	t.Helper()
+
+	exists, err := repos.Rooms.CheckUserExistsInRoom(t.Context(), *room, *user)
+	if err != nil {
+		t.Fatalf("checking room member: %v", err)
+	}
+
+	return exists
+}
+
+func createUser(t *testing.T, repos Repositories) *messagerooms.User {
+	t.Helper()
+
+	return createUserIn(t, messagerooms.Repositories{Users: repos.Users})
+}
+
+// createUserIn creates a user with the repositories of a unit of work.
+func createUserIn(t *testing.T, repos messagerooms.Repositories) *messagerooms.User {
+	t.Helper()
+
+	ctx := t.Context()
+	user, err := repos.Users.Create(ctx, uniqueName("user"), "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	return user
+}
+
+func createRoom(t *testing.T, repos Repositories, owner *messagerooms.User) *messagerooms.Room {
+	t.Helper()
+
+	ctx := t.Context()
+	room, err := repos.Rooms.Create(ctx, uniqueName("room"), *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	return room
+}
+
+// postMessage posts the message in the room and records it as the last activity of the room at postedAt, which the
+// databases may keep with a precision of a second.
+func postMessage(t *testing.T, repos Repositories, room *messagerooms.Room, author *messagerooms.User, text string, postedAt time.Time) *messagerooms.Message {
+	t.Helper()
+
+	ctx := t.Context()
+	message, err := repos.Messages.PostMessage(ctx, *room, *author, text)
+	if err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	message.CreatedAt = postedAt.UTC().Truncate(time.Second)
+	if err := repos.Rooms.RecordMessage(ctx, *room, *message); err != nil {
+		t.Fatalf("recording message: %v", err)
+	}
+
+	return message
+}
+
+// uniqueName returns a name not used by any earlier run of the suite.
+func uniqueName(prefix string) string {
+	return prefix + "-" + uuid.NewV4().String()[:8]
+}
@@ -0,0 +1,48 @@
+package messagerooms
+
+import (
+	"context"
+	"log/slog"
+)
+
+// requestIDKey is the context key for the request id.
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context carrying the request id. The request id follows the work done for a
+// request, up to the events published for it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request id carried by the context, or an empty string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDHandler adds the request id of the context to the records logged with one.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h *requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		r.AddAttrs(slog.String("request_id", requestID))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestIDHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *requestIDHandler) WithGroup(name string) slog.Handler {
+	return &requestIDHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// NewRequestIDHandler wraps the handler so that the records logged with a context carrying a request id include it,
+// the loggers don't need to add it themselves.
+func NewRequestIDHandler(h slog.Handler) slog.Handler {
+	return &requestIDHandler{Handler: h}
+}
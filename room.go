@@ -1,20 +1,138 @@
 package messagerooms
 
-// Room represents a single messaging room.
+import (
+	"context"
+	"time"
+)
+
+// Room represents a single messaging room. The user who created the room owns it and is its first member.
 type Room struct {
-	ID        string `json:"id"`
-	RoomName  string `json:"room_name"`
-	UserID    string `json:"-"`
-	CreatedBy *User  `json:"created_by" gorm:"foreignkey:UserID"`
-	Users     []User `json:"users,omitempty" gorm:"many2many:room_users"`
+	ID             string     `json:"id"`
+	RoomName       string     `json:"room_name"`
+	UserID         string     `json:"-"`
+	CreatedBy      *User      `json:"created_by" gorm:"foreignkey:UserID"`
+	Users          []User     `json:"users,omitempty" gorm:"many2many:room_users"` // Users maps the memberships, the rooms are found without their members
+	MemberCount    int        `json:"member_count"`
+	MessageCount   int        `json:"message_count"`
+	LastActivityAt *time.Time `json:"last_activity_at"` // LastActivityAt is when the last message was posted, nil if there is none
+	LastMessageID  *string    `json:"-"`
+	LastMessage    *Message   `json:"last_message,omitempty" gorm:"foreignkey:LastMessageID"` // LastMessage previews the room in the listings
+}
+
+// GetActivityTopic returns the topic for the high volume activity of the room, like typing and presence. Unlike the
+// personal topics, connections are only subscribed to it on request, while the client is viewing the room.
+func (r *Room) GetActivityTopic() string {
+	return TopicRoomActivity + ":" + r.ID
+}
+
+// roomCreatedEventVersion is the version of the RoomCreatedEvent payload.
+const roomCreatedEventVersion = 1
+
+// RoomCreatedEvent is sent to the owner of a new room on their personal topic, so that every connection of the owner
+// lists the room.
+type RoomCreatedEvent struct {
+	Room Room `json:"room"`
+}
+
+func (e *RoomCreatedEvent) GetTopic() string {
+	return TopicNewRoom + ":" + e.Room.UserID
+}
+
+func (e *RoomCreatedEvent) GetEvent() ServerEvent {
+	return RoomCreatedServerEvent
+}
+
+func (e *RoomCreatedEvent) GetVersion() int {
+	return roomCreatedEventVersion
+}
+
+func (e *RoomCreatedEvent) ToPublish(connID string) *PublishEvent {
+	return NewPublishableEvent(connID, e)
+}
+
+// MembershipChange tells how the members of a room changed.
+type MembershipChange string
+
+// MemberJoined is the change of a user joining the room.
+const MemberJoined MembershipChange = "joined"
+
+// membershipChangedEventVersion is the version of the MembershipChangedEvent payload.
+const membershipChangedEventVersion = 1
+
+// MembershipChangedEvent is sent when the members of a room change. It is published to the activity topic of the
+// room, the connections of the members viewing the room are subscribed to it.
+type MembershipChangedEvent struct {
+	Room   Room             `json:"room"`
+	User   User             `json:"user"`
+	Change MembershipChange `json:"change"`
+}
+
+func (e *MembershipChangedEvent) GetTopic() string {
+	return e.Room.GetActivityTopic()
+}
+
+func (e *MembershipChangedEvent) GetEvent() ServerEvent {
+	return MembershipChangedServerEvent
+}
+
+func (e *MembershipChangedEvent) GetVersion() int {
+	return membershipChangedEventVersion
+}
+
+func (e *MembershipChangedEvent) ToPublish(connID string) *PublishEvent {
+	return NewPublishableEvent(connID, e)
+}
+
+// RoomSort is the order the rooms are listed in. The rooms in the same position are ordered by their id.
+type RoomSort string
+
+const (
+	// SortRoomsByName lists the rooms alphabetically.
+	SortRoomsByName RoomSort = "name"
+
+	// SortRoomsByActivity lists the most recently active rooms first, the rooms without messages last.
+	SortRoomsByActivity RoomSort = "activity"
+
+	// SortRoomsByMembers lists the rooms with the most members first.
+	SortRoomsByMembers RoomSort = "members"
+)
+
+// RoomQuery selects the listed rooms and their order.
+type RoomQuery struct {
+	Search   string   // Search keeps the rooms with a name containing it, ignoring the case
+	MemberID string   // MemberID keeps the rooms the user with the id is a member of
+	Sort     RoomSort // Sort is the order of the rooms, by name if it's empty
+	After    *Room    // After keeps the rooms following it in the order, only its id and the sorted field are used
+	Limit    int      // Limit is the maximum number of rooms, all of them are listed if it's not positive
 }
 
-// RoomRepository provides interface methods for interacting with rooms data store.
+// RoomRepository provides interface methods for interacting with rooms data store. The queries are cancelled along
+// with the context. The returned errors wrap ErrNotFound, ErrConflict or ErrUnavailable.
 type RoomRepository interface {
-	Create(name string, user User) (*Room, error)
-	Find(id string) (*Room, error)
-	FindAll() ([]*Room, error)
-	GetRoomMembers(room Room) ([]*User, error)
-	AddUserToRoom(room Room, user User) error
-	CheckUserExistsInRoom(room Room, user User) bool
+	Create(ctx context.Context, name string, user User) (*Room, error)
+
+	// Find returns the room with its owner, the number of its members and its last message. The members are not
+	// loaded.
+	Find(ctx context.Context, id string) (*Room, error)
+
+	// Lookup returns the room without loading its owner nor its last message. It takes a single query, for checking
+	// the room exists and who owns it.
+	Lookup(ctx context.Context, id string) (*Room, error)
+
+	// FindAll returns the rooms matching the query, with their owner, the number of their members and their last
+	// message.
+	FindAll(ctx context.Context, query RoomQuery) ([]*Room, error)
+
+	// GetRoomMembers returns every member of the room, the messages posted in the room are published to each of them.
+	GetRoomMembers(ctx context.Context, room Room) ([]*User, error)
+
+	// ListRoomMembers returns at most limit members of the room ordered by their nickname, starting after the
+	// nickname after, or with the first member if it's empty.
+	ListRoomMembers(ctx context.Context, room Room, after string, limit int) ([]*User, error)
+
+	AddUserToRoom(ctx context.Context, room Room, user User) error
+	CheckUserExistsInRoom(ctx context.Context, room Room, user User) (bool, error)
+
+	// RecordMessage counts the message posted in the room as its last message.
+	RecordMessage(ctx context.Context, room Room, message Message) error
 }
@@ -0,0 +1,55 @@
+package room
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// roomCursor is the position of the last room of a page in the order of the listing. It is returned to the client
+// encoded, the client is not expected to read it.
+type roomCursor struct {
+	Sort           messagerooms.RoomSort `json:"sort"`
+	ID             string                `json:"id"`
+	RoomName       string                `json:"name,omitempty"`
+	MemberCount    int                   `json:"members,omitempty"`
+	LastActivityAt *time.Time            `json:"activity,omitempty"`
+}
+
+// encodeRoomCursor returns the cursor listing the rooms after the room in the order.
+func encodeRoomCursor(order messagerooms.RoomSort, room *messagerooms.Room) string {
+	cursor := roomCursor{Sort: order, ID: room.ID}
+	switch order {
+	case messagerooms.SortRoomsByActivity:
+		cursor.LastActivityAt = room.LastActivityAt
+	case messagerooms.SortRoomsByMembers:
+		cursor.MemberCount = room.MemberCount
+	default:
+		cursor.RoomName = room.RoomName
+	}
+
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeRoomCursor returns the room the cursor lists the rooms after, with its id and the field of the order.
+func decodeRoomCursor(order messagerooms.RoomSort, encoded string) (*messagerooms.Room, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor roomCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.Sort != order || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &messagerooms.Room{
+		ID:             cursor.ID,
+		RoomName:       cursor.RoomName,
+		MemberCount:    cursor.MemberCount,
+		LastActivityAt: cursor.LastActivityAt,
+	}, nil
+}
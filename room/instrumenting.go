@@ -1,6 +1,8 @@
 package room
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/metrics"
@@ -13,70 +15,89 @@ type instrumentingService struct {
 	next           Service
 }
 
-func (s *instrumentingService) CreateNewRoom(roomName string, user messagerooms.User) (*messagerooms.Room, error) {
+func (s *instrumentingService) CreateNewRoom(ctx context.Context, roomName string, user messagerooms.User) (room *messagerooms.Room, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "create_room").Add(1)
+		s.requestCount.With("method", "create_room", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "create_room").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.CreateNewRoom(roomName, user)
+	return s.next.CreateNewRoom(ctx, roomName, user)
 }
 
-func (s *instrumentingService) RoomDetails(id string) (*messagerooms.Room, error) {
+func (s *instrumentingService) RoomDetails(ctx context.Context, id string) (room *messagerooms.Room, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "room_details").Add(1)
+		s.requestCount.With("method", "room_details", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "room_details").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.RoomDetails(id)
+	return s.next.RoomDetails(ctx, id)
 }
 
-func (s *instrumentingService) AllRooms() ([]*messagerooms.Room, error) {
+func (s *instrumentingService) FindRoom(ctx context.Context, id string) (room *messagerooms.Room, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "all_rooms").Add(1)
-		s.requestLatency.With("method", "all_rooms").Observe(time.Since(begin).Seconds())
+		s.requestCount.With("method", "find_room", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "find_room").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.AllRooms()
+	return s.next.FindRoom(ctx, id)
 }
 
-func (s *instrumentingService) AddUserToRoom(room messagerooms.Room, user messagerooms.User) error {
+func (s *instrumentingService) ListRooms(ctx context.Context, options ListOptions) (rooms []*messagerooms.Room, next string, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "add_user_to_room").Add(1)
+		s.requestCount.With("method", "list_rooms", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "list_rooms").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.ListRooms(ctx, options)
+}
+
+func (s *instrumentingService) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "add_user_to_room", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "add_user_to_room").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.AddUserToRoom(room, user)
+	return s.next.AddUserToRoom(ctx, room, user)
 }
 
-func (s *instrumentingService) CheckUserExistsInRoom(room messagerooms.Room, user messagerooms.User) bool {
+func (s *instrumentingService) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (exists bool, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "check_user_exists_in_room").Add(1)
+		s.requestCount.With("method", "check_user_exists_in_room", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "check_user_exists_in_room").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.CheckUserExistsInRoom(room, user)
+	return s.next.CheckUserExistsInRoom(ctx, room, user)
+}
+
+func (s *instrumentingService) RoomMembers(ctx context.Context, room messagerooms.Room, cursor string, limit int) (members []*messagerooms.User, next string, err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "room_members", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "room_members").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.RoomMembers(ctx, room, cursor, limit)
 }
 
-func (s *instrumentingService) GetAllRoomMessages(room messagerooms.Room) ([]*messagerooms.Message, error) {
+func (s *instrumentingService) GetAllRoomMessages(ctx context.Context, room messagerooms.Room) (messages []*messagerooms.Message, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "get_all_room_messages").Add(1)
+		s.requestCount.With("method", "get_all_room_messages", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "get_all_room_messages").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.GetAllRoomMessages(room)
+	return s.next.GetAllRoomMessages(ctx, room)
 }
 
-func (s *instrumentingService) PostMessage(room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error) {
+func (s *instrumentingService) PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (message *messagerooms.Message, err error) {
 	defer func(begin time.Time) {
-		s.requestCount.With("method", "post_message").Add(1)
+		s.requestCount.With("method", "post_message", "error", fmt.Sprint(err != nil)).Add(1)
 		s.requestLatency.With("method", "post_message").Observe(time.Since(begin).Seconds())
 	}(time.Now())
 
-	return s.next.PostMessage(room, user, messageText)
+	return s.next.PostMessage(ctx, room, user, messageText)
 }
 
-// NewInstrumentingService returns an instance of an instrumenting Service.
+// NewInstrumentingService returns an instance of an instrumenting Service. The counter is labelled by method and
+// whether the call failed, the histogram by method.
 func NewInstrumentingService(counter metrics.Counter, summary metrics.Histogram, s Service) Service {
 	return &instrumentingService{
 		requestCount:   counter,
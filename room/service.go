@@ -1,68 +1,197 @@
 package room
 
 import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
 	"github.com/iamsayantan/messagerooms"
 	"github.com/iamsayantan/messagerooms/pubsub"
 	"github.com/pkg/errors"
 )
 
 var (
-	// ErrUserAlreadyInRoom is returned when user tries to join same room twice.
-	ErrUserAlreadyInRoom = errors.New("user is already in room")
+	// ErrUserAlreadyInRoom is returned when user tries to join same room twice. It is the conflict reported by the
+	// repository when the membership is checked concurrently.
+	ErrUserAlreadyInRoom = messagerooms.ErrUserAlreadyMember
 
 	// ErrUserNotInRoom is returned when user tries to do something that reburies him to be a member of the room
 	ErrUserNotInRoom = errors.New("user is not a member of the room")
+
+	// ErrRealtimeDeliveryFailed is returned along with the posted message when the message was saved but could not
+	// be published to all the room members.
+	ErrRealtimeDeliveryFailed = errors.New("message could not be delivered in realtime")
+
+	// ErrInvalidSort is returned when the rooms are listed in an unknown order.
+	ErrInvalidSort = errors.New("rooms can only be sorted by name, activity or members")
+
+	// ErrInvalidCursor is returned when the cursor of a listing is malformed, or was returned for another order.
+	ErrInvalidCursor = errors.New("the cursor is not valid for the listing")
+)
+
+const (
+	// maxDeliveryAttempts is the number of times publishing an event is tried before giving up.
+	maxDeliveryAttempts = 3
+
+	// deliveryRetryBackoff is the base wait time between two publish attempts, it grows with every attempt.
+	deliveryRetryBackoff = 100 * time.Millisecond
+
+	// deliveryTimeout limits the total time spent on publishing an event, along with its retries.
+	deliveryTimeout = 5 * time.Second
+
+	// maxConcurrentDeliveries is the number of room members a message is published to at the same time.
+	maxConcurrentDeliveries = 16
+)
+
+const (
+	// DefaultMembersPageSize is the number of members listed in a page when no limit is given.
+	DefaultMembersPageSize = 50
+
+	// MaxMembersPageSize is the largest number of members listed in a page.
+	MaxMembersPageSize = 200
+
+	// DefaultRoomsPageSize is the number of rooms listed in a page when no limit is given.
+	DefaultRoomsPageSize = 50
+
+	// MaxRoomsPageSize is the largest number of rooms listed in a page.
+	MaxRoomsPageSize = 200
 )
 
-// Service provides methods for room management.
+// ListOptions select the rooms listed in a page and their order.
+type ListOptions struct {
+	Search   string                // Search keeps the rooms with a name containing it, ignoring the case
+	JoinedBy *messagerooms.User    // JoinedBy keeps the rooms the user is a member of, if set
+	Sort     messagerooms.RoomSort // Sort is the order of the rooms, by name if it's empty
+	Cursor   string                // Cursor is the one returned with the previous page, the first page is listed if it's empty
+	Limit    int                   // Limit is bounded by MaxRoomsPageSize, DefaultRoomsPageSize is used if it's not positive
+}
+
+// Service provides methods for room management. The storage is queried with the context of the call, so the work of
+// a cancelled request is cancelled too. The errors of the storage are returned as they are, they wrap one of the error
+// kinds of the messagerooms package.
 type Service interface {
-	// CreateNewRoom creates a new room.
-	CreateNewRoom(roomName string, user messagerooms.User) (*messagerooms.Room, error)
+	// CreateNewRoom creates a new room, owned by the user who is added as its first member. The room is published to
+	// the owner's connections once it's created.
+	CreateNewRoom(ctx context.Context, roomName string, user messagerooms.User) (*messagerooms.Room, error)
 
 	// RoomDetails returns details for the room with the id. Error is returned in case of invalid id.
-	RoomDetails(id string) (*messagerooms.Room, error)
+	RoomDetails(ctx context.Context, id string) (*messagerooms.Room, error)
+
+	// FindRoom returns the room with the id without its owner nor its last message, for the requests that only need
+	// the room to exist, like posting a message or joining the room.
+	FindRoom(ctx context.Context, id string) (*messagerooms.Room, error)
 
-	// AllRooms returns list of all rooms available
-	AllRooms() ([]*messagerooms.Room, error)
+	// ListRooms returns a page of the rooms selected by the options, along with their last message. The returned
+	// cursor lists the next page with the same options, it's empty on the last page.
+	ListRooms(ctx context.Context, options ListOptions) ([]*messagerooms.Room, string, error)
 
-	// AddUserToRoom adds an user to a room.
-	AddUserToRoom(room messagerooms.Room, user messagerooms.User) error
+	// AddUserToRoom adds an user to a room. The new member is published to the connections viewing the room once it
+	// joined.
+	AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) error
 
 	// CheckUserExistsInRoom checks if an user is member of a room.
-	CheckUserExistsInRoom(room messagerooms.Room, user messagerooms.User) bool
+	CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (bool, error)
+
+	// RoomMembers returns a page of the room members ordered by their nickname, starting after the cursor returned
+	// with the previous page. The limit is bounded by MaxMembersPageSize, DefaultMembersPageSize is used if it's not
+	// positive. The returned cursor is empty on the last page.
+	RoomMembers(ctx context.Context, room messagerooms.Room, cursor string, limit int) ([]*messagerooms.User, string, error)
 
 	// GetAllRoomMessages returns all the messages posted in a room.
-	GetAllRoomMessages(room messagerooms.Room) ([]*messagerooms.Message, error)
+	GetAllRoomMessages(ctx context.Context, room messagerooms.Room) ([]*messagerooms.Message, error)
 
-	// PostMessage posts a message in a room.
-	PostMessage(room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error)
+	// PostMessage posts a message in a room and publishes it to the personal topic of every room member. The message is
+	// saved along with the activity of the room, the message count and the last activity time. If the message is saved
+	// but the publishing fails, the message is returned along with ErrRealtimeDeliveryFailed. The published events
+	// carry the request id of the context.
+	PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error)
 }
 
 type roomService struct {
 	room      messagerooms.RoomRepository
 	message   messagerooms.MessageRepository
+	uow       messagerooms.UnitOfWork
 	publisher pubsub.Service
+	logger    *slog.Logger
 }
 
-func (s *roomService) AllRooms() ([]*messagerooms.Room, error) {
-	return s.room.FindAll()
+func (s *roomService) ListRooms(ctx context.Context, options ListOptions) ([]*messagerooms.Room, string, error) {
+	query := messagerooms.RoomQuery{Search: options.Search, Sort: options.Sort}
+	switch query.Sort {
+	case "":
+		query.Sort = messagerooms.SortRoomsByName
+	case messagerooms.SortRoomsByName, messagerooms.SortRoomsByActivity, messagerooms.SortRoomsByMembers:
+	default:
+		return nil, "", ErrInvalidSort
+	}
+
+	if options.JoinedBy != nil {
+		query.MemberID = options.JoinedBy.ID
+	}
+
+	if options.Cursor != "" {
+		after, err := decodeRoomCursor(query.Sort, options.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+
+		query.After = after
+	}
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = DefaultRoomsPageSize
+	}
+
+	if limit > MaxRoomsPageSize {
+		limit = MaxRoomsPageSize
+	}
+
+	// one more room is listed to know whether there is a next page.
+	query.Limit = limit + 1
+	rooms, err := s.room.FindAll(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(rooms) <= limit {
+		return rooms, "", nil
+	}
+
+	rooms = rooms[:limit]
+	return rooms, encodeRoomCursor(query.Sort, rooms[limit-1]), nil
 }
 
-func (s *roomService) GetAllRoomMessages(room messagerooms.Room) ([]*messagerooms.Message, error) {
-	return s.message.GetMessagesByRoom(room)
+func (s *roomService) GetAllRoomMessages(ctx context.Context, room messagerooms.Room) ([]*messagerooms.Message, error) {
+	return s.message.GetMessagesByRoom(ctx, room)
 }
 
-func (s *roomService) CreateNewRoom(roomName string, user messagerooms.User) (*messagerooms.Room, error) {
-	room, err := s.room.Create(roomName, user)
+func (s *roomService) CreateNewRoom(ctx context.Context, roomName string, user messagerooms.User) (*messagerooms.Room, error) {
+	var room *messagerooms.Room
+	err := s.uow.Do(ctx, func(repos messagerooms.Repositories) error {
+		var err error
+		if room, err = repos.Rooms.Create(ctx, roomName, user); err != nil {
+			return err
+		}
+
+		return repos.Rooms.AddUserToRoom(ctx, *room, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.RoomDetails(ctx, room.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.RoomDetails(room.ID)
+	s.publishRoomEvent(ctx, &messagerooms.RoomCreatedEvent{Room: *created})
+	return created, nil
 }
 
-func (s *roomService) RoomDetails(id string) (*messagerooms.Room, error) {
-	room, err := s.room.Find(id)
+func (s *roomService) RoomDetails(ctx context.Context, id string) (*messagerooms.Room, error) {
+	room, err := s.room.Find(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -70,47 +199,181 @@ func (s *roomService) RoomDetails(id string) (*messagerooms.Room, error) {
 	return room, nil
 }
 
-func (s *roomService) AddUserToRoom(room messagerooms.Room, user messagerooms.User) error {
-	if exists := s.room.CheckUserExistsInRoom(room, user); exists {
-		return ErrUserAlreadyInRoom
+func (s *roomService) FindRoom(ctx context.Context, id string) (*messagerooms.Room, error) {
+	return s.room.Lookup(ctx, id)
+}
+
+func (s *roomService) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) error {
+	err := s.uow.Do(ctx, func(repos messagerooms.Repositories) error {
+		exists, err := repos.Rooms.CheckUserExistsInRoom(ctx, room, user)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return ErrUserAlreadyInRoom
+		}
+
+		return repos.Rooms.AddUserToRoom(ctx, room, user)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the room is published with the new member count, the one given is from before the user joined.
+	if joined, err := s.room.Find(ctx, room.ID); err == nil {
+		room = *joined
 	}
 
-	err := s.room.AddUserToRoom(room, user)
-	return err
+	s.publishRoomEvent(ctx, &messagerooms.MembershipChangedEvent{Room: room, User: user, Change: messagerooms.MemberJoined})
+	return nil
 }
 
-func (s *roomService) CheckUserExistsInRoom(room messagerooms.Room, user messagerooms.User) bool {
-	return s.room.CheckUserExistsInRoom(room, user)
+func (s *roomService) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (bool, error) {
+	return s.room.CheckUserExistsInRoom(ctx, room, user)
 }
 
-func (s *roomService) PostMessage(room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error) {
-	if exists := s.room.CheckUserExistsInRoom(room, user); !exists {
-		return nil, ErrUserNotInRoom
+func (s *roomService) RoomMembers(ctx context.Context, room messagerooms.Room, cursor string, limit int) ([]*messagerooms.User, string, error) {
+	if limit <= 0 {
+		limit = DefaultMembersPageSize
 	}
 
-	message, err := s.message.PostMessage(room, user, messageText)
+	if limit > MaxMembersPageSize {
+		limit = MaxMembersPageSize
+	}
+
+	// one more member is listed to know whether there is a next page.
+	members, err := s.room.ListRoomMembers(ctx, room, cursor, limit+1)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// publishing the new message into the pubsub system.
-	go func() {
-		users, _ := s.room.GetRoomMembers(room)
-		for _, user := range users {
-			messageEvent := messagerooms.NewMessageEvent{User: *user, Room: room, Message: *message}
-			s.publisher.Publish(&messageEvent)
+	if len(members) <= limit {
+		return members, "", nil
+	}
+
+	members = members[:limit]
+	return members, members[limit-1].Nickname, nil
+}
+
+func (s *roomService) PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (*messagerooms.Message, error) {
+	var message *messagerooms.Message
+	err := s.uow.Do(ctx, func(repos messagerooms.Repositories) error {
+		exists, err := repos.Rooms.CheckUserExistsInRoom(ctx, room, user)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return ErrUserNotInRoom
 		}
-	}()
+
+		if message, err = repos.Messages.PostMessage(ctx, room, user, messageText); err != nil {
+			return err
+		}
+
+		return repos.Rooms.RecordMessage(ctx, room, *message)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// publishing the new message into the pubsub system. The message is already saved at this point, so a failed
+	// delivery is reported along with the message instead of failing the whole operation.
+	if err := s.deliverMessage(ctx, room, *message); err != nil {
+		return message, errors.Wrap(ErrRealtimeDeliveryFailed, err.Error())
+	}
 
 	return message, nil
 }
 
-// NewService returns a new room service with associated dependency.
-func NewService(rs messagerooms.RoomRepository, ms messagerooms.MessageRepository, pub pubsub.Service) Service {
+// deliverMessage publishes the message to the personal topic of every member of the room. The members are published
+// to concurrently, so a member whose publish is retried does not hold up the others. The last error is returned if
+// the delivery to any of the members failed.
+func (s *roomService) deliverMessage(ctx context.Context, room messagerooms.Room, message messagerooms.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deliveryTimeout)
+	defer cancel()
+
+	users, err := s.room.GetRoomMembers(ctx, room)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lastErr error
+	)
+
+	sem := make(chan struct{}, maxConcurrentDeliveries)
+	for _, user := range users {
+		messageEvent := &messagerooms.NewMessageEvent{User: *user, Room: room, Message: message}
+
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if err := s.publish(ctx, messageEvent); err != nil {
+				mu.Lock()
+				lastErr = err
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return lastErr
+}
+
+// publishRoomEvent publishes the event of a change of the room. The change is saved already and the clients see it
+// the next time they load the room, so a failed publish is only logged.
+func (s *roomService) publishRoomEvent(ctx context.Context, data messagerooms.Publishable) {
+	if err := s.publish(ctx, data); err != nil {
+		s.logger.ErrorContext(ctx, "publishing room event failed", "event", data.GetEvent(), "topic", data.GetTopic(), "err", err)
+	}
+}
+
+// publish publishes the event of a change that is already saved, so the publishing goes on even if the request is
+// cancelled. The publish is retried a few times before giving up, the last error is returned then.
+func (s *roomService) publish(ctx context.Context, data messagerooms.Publishable) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deliveryTimeout)
+	defer cancel()
+
+	var err error
+	for attempt := 1; attempt <= maxDeliveryAttempts; attempt++ {
+		if err = s.publisher.Publish(ctx, data); err == nil {
+			return nil
+		}
+
+		s.logger.WarnContext(ctx, "publishing event failed", "topic", data.GetTopic(), "attempt", attempt, "err", err)
+
+		if attempt == maxDeliveryAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * deliveryRetryBackoff):
+		case <-ctx.Done():
+			return err
+		}
+	}
+
+	return err
+}
+
+// NewService returns a new room service with associated dependency. The changes spanning several repositories are
+// made in the units of work of uow, which must share the storage of the repositories.
+func NewService(rs messagerooms.RoomRepository, ms messagerooms.MessageRepository, uow messagerooms.UnitOfWork, pub pubsub.Service, logger *slog.Logger) Service {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
 	service := &roomService{
 		room:      rs,
 		message:   ms,
+		uow:       uow,
 		publisher: pub,
+		logger:    logger,
 	}
 
 	return service
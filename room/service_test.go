@@ -0,0 +1,406 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/inmem"
+)
+
+// recordingPublisher is a pubsub.Service keeping the published events, or failing them with err.
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []messagerooms.Publishable
+	err       error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, data messagerooms.Publishable) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+
+	p.published = append(p.published, data)
+	return nil
+}
+
+func (p *recordingPublisher) Subscribe(ctx context.Context, connectionID string, topics ...string) error {
+	return nil
+}
+
+func (p *recordingPublisher) Unsubscribe(ctx context.Context, connectionID string, topics ...string) error {
+	return nil
+}
+
+func (p *recordingPublisher) HealthCheck(ctx context.Context) error { return nil }
+
+func (p *recordingPublisher) Close() error { return nil }
+
+// publishedOf returns the published events of the type E.
+func publishedOf[E messagerooms.Publishable](p *recordingPublisher) []E {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []E
+	for _, data := range p.published {
+		if event, ok := data.(E); ok {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+type fixture struct {
+	service   Service
+	users     messagerooms.UserRepository
+	publisher *recordingPublisher
+}
+
+func newFixture() *fixture {
+	db := inmem.NewDB()
+	publisher := &recordingPublisher{}
+
+	return &fixture{
+		service:   NewService(inmem.NewRoomRepository(db), inmem.NewMessageRepository(db), inmem.NewUnitOfWork(db), publisher, nil),
+		users:     inmem.NewUserRepository(db),
+		publisher: publisher,
+	}
+}
+
+func (f *fixture) createUser(t *testing.T, nickname string) *messagerooms.User {
+	t.Helper()
+
+	user, err := f.users.Create(t.Context(), nickname, "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	return user
+}
+
+func TestCreateNewRoom(t *testing.T) {
+	f := newFixture()
+	owner := f.createUser(t, "alice")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	if room.RoomName != "general" || room.CreatedBy == nil || room.CreatedBy.ID != owner.ID {
+		t.Errorf("created room = %+v, want general created by %s", room, owner.ID)
+	}
+
+	if room.MemberCount != 1 {
+		t.Errorf("created room member count = %d, want only the owner to be a member", room.MemberCount)
+	}
+
+	rooms, _, err := f.service.ListRooms(t.Context(), ListOptions{})
+	if err != nil {
+		t.Fatalf("listing rooms: %v", err)
+	}
+
+	if len(rooms) != 1 || rooms[0].ID != room.ID {
+		t.Errorf("rooms = %+v, want only %s", rooms, room.ID)
+	}
+}
+
+func TestCreateNewRoomPublishesRoom(t *testing.T) {
+	f := newFixture()
+	owner := f.createUser(t, "alice")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	events := publishedOf[*messagerooms.RoomCreatedEvent](f.publisher)
+	if len(events) != 1 {
+		t.Fatalf("published rooms = %+v, want only the created room", events)
+	}
+
+	event := events[0]
+	if event.GetEvent() != messagerooms.RoomCreatedServerEvent {
+		t.Errorf("room published as %s, want %s", event.GetEvent(), messagerooms.RoomCreatedServerEvent)
+	}
+
+	// the room is published to the personal topic of the owner, their connections are always subscribed to it.
+	if topic := event.GetTopic(); !slices.Contains(owner.GetPersonalTopics(), topic) {
+		t.Errorf("room published on %s, want one of the owner's personal topics %v", topic, owner.GetPersonalTopics())
+	}
+
+	if event.Room.ID != room.ID || event.Room.RoomName != "general" || event.Room.MemberCount != 1 {
+		t.Errorf("published room = %+v, want general with its owner as member", event.Room)
+	}
+}
+
+func TestAddUserToRoomPublishesMembership(t *testing.T) {
+	f := newFixture()
+	owner := f.createUser(t, "alice")
+	member := f.createUser(t, "bob")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	if err := f.service.AddUserToRoom(t.Context(), *room, *member); err != nil {
+		t.Fatalf("joining room: %v", err)
+	}
+
+	// joining twice changes nothing, and nothing more is published.
+	if err := f.service.AddUserToRoom(t.Context(), *room, *member); err != ErrUserAlreadyInRoom {
+		t.Fatalf("joining room again: err = %v, want %v", err, ErrUserAlreadyInRoom)
+	}
+
+	events := publishedOf[*messagerooms.MembershipChangedEvent](f.publisher)
+	if len(events) != 1 {
+		t.Fatalf("published membership changes = %+v, want only bob joining", events)
+	}
+
+	event := events[0]
+	if event.GetEvent() != messagerooms.MembershipChangedServerEvent {
+		t.Errorf("membership change published as %s, want %s", event.GetEvent(), messagerooms.MembershipChangedServerEvent)
+	}
+
+	if topic := event.GetTopic(); topic != room.GetActivityTopic() {
+		t.Errorf("membership change published on %s, want %s", topic, room.GetActivityTopic())
+	}
+
+	if event.User.ID != member.ID || event.Change != messagerooms.MemberJoined {
+		t.Errorf("published change = %s of %+v, want %s of %s", event.Change, event.User, messagerooms.MemberJoined, member.ID)
+	}
+
+	if event.Room.ID != room.ID || event.Room.MemberCount != 2 {
+		t.Errorf("published room = %+v, want %s with 2 members", event.Room, room.ID)
+	}
+}
+
+func TestAddUserToRoomTwice(t *testing.T) {
+	f := newFixture()
+	owner := f.createUser(t, "alice")
+	member := f.createUser(t, "bob")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	if err := f.service.AddUserToRoom(t.Context(), *room, *owner); err != ErrUserAlreadyInRoom {
+		t.Errorf("owner joining room: err = %v, want %v", err, ErrUserAlreadyInRoom)
+	}
+
+	if err := f.service.AddUserToRoom(t.Context(), *room, *member); err != nil {
+		t.Fatalf("joining room: %v", err)
+	}
+
+	if err := f.service.AddUserToRoom(t.Context(), *room, *member); err != ErrUserAlreadyInRoom {
+		t.Errorf("joining room again: err = %v, want %v", err, ErrUserAlreadyInRoom)
+	}
+}
+
+func TestRoomMembers(t *testing.T) {
+	f := newFixture()
+	alice := f.createUser(t, "alice")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *alice)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	for _, nickname := range []string{"carol", "bob"} {
+		if err := f.service.AddUserToRoom(t.Context(), *room, *f.createUser(t, nickname)); err != nil {
+			t.Fatalf("joining room: %v", err)
+		}
+	}
+
+	var cursor string
+	for _, want := range [][]string{{"alice", "bob"}, {"carol"}} {
+		members, next, err := f.service.RoomMembers(t.Context(), *room, cursor, 2)
+		if err != nil {
+			t.Fatalf("listing members: %v", err)
+		}
+
+		var got []string
+		for _, member := range members {
+			got = append(got, member.Nickname)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("members after %q = %v, want %v", cursor, got, want)
+		}
+
+		cursor = next
+	}
+
+	if cursor != "" {
+		t.Errorf("cursor after the last page = %q, want none", cursor)
+	}
+}
+
+func TestListRooms(t *testing.T) {
+	f := newFixture()
+	alice := f.createUser(t, "alice")
+	bob := f.createUser(t, "bob")
+
+	for _, name := range []string{"random", "general", "games"} {
+		if _, err := f.service.CreateNewRoom(t.Context(), name, *alice); err != nil {
+			t.Fatalf("creating room: %v", err)
+		}
+	}
+
+	var cursor string
+	for _, want := range [][]string{{"games", "general"}, {"random"}} {
+		rooms, next, err := f.service.ListRooms(t.Context(), ListOptions{Cursor: cursor, Limit: 2})
+		if err != nil {
+			t.Fatalf("listing rooms: %v", err)
+		}
+
+		var got []string
+		for _, room := range rooms {
+			got = append(got, room.RoomName)
+		}
+
+		if !slices.Equal(got, want) {
+			t.Fatalf("rooms after %q = %v, want %v", cursor, got, want)
+		}
+
+		cursor = next
+	}
+
+	if cursor != "" {
+		t.Errorf("cursor after the last page = %q, want none", cursor)
+	}
+
+	rooms, _, err := f.service.ListRooms(t.Context(), ListOptions{Search: "GA", JoinedBy: alice})
+	if err != nil {
+		t.Fatalf("listing rooms: %v", err)
+	}
+
+	if len(rooms) != 1 || rooms[0].RoomName != "games" {
+		t.Errorf("rooms searched for GA = %+v, want only games", rooms)
+	}
+
+	if rooms, _, err = f.service.ListRooms(t.Context(), ListOptions{JoinedBy: bob}); err != nil || len(rooms) != 0 {
+		t.Errorf("rooms joined by bob = %+v, %v, want none", rooms, err)
+	}
+
+	_, next, err := f.service.ListRooms(t.Context(), ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("listing rooms: %v", err)
+	}
+
+	// the cursor keeps the position in one order only.
+	options := ListOptions{Sort: messagerooms.SortRoomsByMembers, Cursor: next}
+	if _, _, err := f.service.ListRooms(t.Context(), options); err != ErrInvalidCursor {
+		t.Errorf("listing rooms with the cursor of another order: err = %v, want %v", err, ErrInvalidCursor)
+	}
+
+	if _, _, err := f.service.ListRooms(t.Context(), ListOptions{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+		t.Errorf("listing rooms with a malformed cursor: err = %v, want %v", err, ErrInvalidCursor)
+	}
+
+	if _, _, err := f.service.ListRooms(t.Context(), ListOptions{Sort: "age"}); err != ErrInvalidSort {
+		t.Errorf("listing rooms by an unknown order: err = %v, want %v", err, ErrInvalidSort)
+	}
+}
+
+func TestPostMessage(t *testing.T) {
+	f := newFixture()
+	alice := f.createUser(t, "alice")
+	bob := f.createUser(t, "bob")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *alice)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	if _, err := f.service.PostMessage(t.Context(), *room, *bob, "hello"); err != ErrUserNotInRoom {
+		t.Errorf("posting without joining: err = %v, want %v", err, ErrUserNotInRoom)
+	}
+
+	if err := f.service.AddUserToRoom(t.Context(), *room, *bob); err != nil {
+		t.Fatalf("joining room: %v", err)
+	}
+
+	message, err := f.service.PostMessage(t.Context(), *room, *alice, "hello")
+	if err != nil {
+		t.Fatalf("posting message: %v", err)
+	}
+
+	details, err := f.service.RoomDetails(t.Context(), room.ID)
+	if err != nil {
+		t.Fatalf("getting room details: %v", err)
+	}
+
+	if details.MessageCount != 1 || details.LastActivityAt == nil || !details.LastActivityAt.Equal(message.CreatedAt) {
+		t.Errorf("room has %d messages and last activity at %v, want 1 and %v", details.MessageCount, details.LastActivityAt, message.CreatedAt)
+	}
+
+	messages, err := f.service.GetAllRoomMessages(t.Context(), *room)
+	if err != nil {
+		t.Fatalf("getting messages: %v", err)
+	}
+
+	if len(messages) != 1 || messages[0].ID != message.ID {
+		t.Errorf("room messages = %+v, want only %s", messages, message.ID)
+	}
+
+	// every member is sent the message on their personal topic, whichever room they are viewing.
+	events := publishedOf[*messagerooms.NewMessageEvent](f.publisher)
+	topics := make(map[string]bool)
+	for _, event := range events {
+		if event.Message.ID != message.ID || event.GetEvent() != messagerooms.NewMessageServerEvent {
+			t.Errorf("published message = %+v as %s, want the message %s", event.Message, event.GetEvent(), message.ID)
+		}
+
+		topics[event.GetTopic()] = true
+	}
+
+	if len(events) != 2 {
+		t.Errorf("published %d messages, want one per member", len(events))
+	}
+
+	for _, user := range []*messagerooms.User{alice, bob} {
+		if topic := messagerooms.TopicNewMessage + ":" + user.ID; !topics[topic] {
+			t.Errorf("no message published on %s", topic)
+		}
+	}
+}
+
+func TestPostMessageDeliveryFailure(t *testing.T) {
+	f := newFixture()
+	alice := f.createUser(t, "alice")
+	f.publisher.err = errors.New("pubsub is down")
+
+	room, err := f.service.CreateNewRoom(t.Context(), "general", *alice)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	// the message is saved even though it could not be delivered.
+	message, err := f.service.PostMessage(t.Context(), *room, *alice, "hello")
+	if !errors.Is(err, ErrRealtimeDeliveryFailed) {
+		t.Fatalf("posting message: err = %v, want %v", err, ErrRealtimeDeliveryFailed)
+	}
+
+	if message == nil {
+		t.Fatal("posting message returned no message")
+	}
+
+	messages, err := f.service.GetAllRoomMessages(t.Context(), *room)
+	if err != nil {
+		t.Fatalf("getting messages: %v", err)
+	}
+
+	if len(messages) != 1 || messages[0].ID != message.ID {
+		t.Errorf("room messages = %+v, want only %s", messages, message.ID)
+	}
+}
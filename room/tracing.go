@@ -0,0 +1,121 @@
+package room
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingService traces the calls to the room service. The spans join the trace of the context, and the repositories
+// are called with the context of the span.
+type tracingService struct {
+	tracer trace.Tracer
+	next   Service
+}
+
+func (s *tracingService) CreateNewRoom(ctx context.Context, roomName string, user messagerooms.User) (room *messagerooms.Room, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.CreateNewRoom", trace.WithAttributes(
+		attribute.String("user.id", user.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.CreateNewRoom(ctx, roomName, user)
+}
+
+func (s *tracingService) RoomDetails(ctx context.Context, id string) (room *messagerooms.Room, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.RoomDetails", trace.WithAttributes(
+		attribute.String("room.id", id),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.RoomDetails(ctx, id)
+}
+
+func (s *tracingService) FindRoom(ctx context.Context, id string) (room *messagerooms.Room, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.FindRoom", trace.WithAttributes(
+		attribute.String("room.id", id),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.FindRoom(ctx, id)
+}
+
+func (s *tracingService) ListRooms(ctx context.Context, options ListOptions) (rooms []*messagerooms.Room, next string, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.ListRooms", trace.WithAttributes(
+		attribute.String("rooms.sort", string(options.Sort)),
+		attribute.Bool("rooms.joined", options.JoinedBy != nil),
+		attribute.Int("page.limit", options.Limit),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.ListRooms(ctx, options)
+}
+
+func (s *tracingService) AddUserToRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (err error) {
+	ctx, span := s.tracer.Start(ctx, "room.AddUserToRoom", trace.WithAttributes(
+		attribute.String("room.id", room.ID),
+		attribute.String("user.id", user.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.AddUserToRoom(ctx, room, user)
+}
+
+func (s *tracingService) CheckUserExistsInRoom(ctx context.Context, room messagerooms.Room, user messagerooms.User) (exists bool, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.CheckUserExistsInRoom", trace.WithAttributes(
+		attribute.String("room.id", room.ID),
+		attribute.String("user.id", user.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.CheckUserExistsInRoom(ctx, room, user)
+}
+
+func (s *tracingService) RoomMembers(ctx context.Context, room messagerooms.Room, cursor string, limit int) (members []*messagerooms.User, next string, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.RoomMembers", trace.WithAttributes(
+		attribute.String("room.id", room.ID),
+		attribute.Int("page.limit", limit),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.RoomMembers(ctx, room, cursor, limit)
+}
+
+func (s *tracingService) GetAllRoomMessages(ctx context.Context, room messagerooms.Room) (messages []*messagerooms.Message, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.GetAllRoomMessages", trace.WithAttributes(
+		attribute.String("room.id", room.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.GetAllRoomMessages(ctx, room)
+}
+
+func (s *tracingService) PostMessage(ctx context.Context, room messagerooms.Room, user messagerooms.User, messageText string) (message *messagerooms.Message, err error) {
+	ctx, span := s.tracer.Start(ctx, "room.PostMessage", trace.WithAttributes(
+		attribute.String("room.id", room.ID),
+		attribute.String("user.id", user.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.PostMessage(ctx, room, user, messageText)
+}
+
+// NewTracingService returns an instance of a tracing Service.
+func NewTracingService(tracer trace.Tracer, s Service) Service {
+	return &tracingService{
+		tracer: tracer,
+		next:   s,
+	}
+}
+
+// endSpan records the error of the traced call, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout limits the time spent on a health check, a dependency slower than that is considered down.
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck reports whether a dependency of the server is usable, it returns an error if it is not.
+type HealthCheck func(ctx context.Context) error
+
+// healthResponse is the result of the health checks, keyed by the name of the checks.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// healthHandler serves the probes of the orchestrator. The liveness probe only checks the hub goroutines, which
+// can not recover without a restart. The readiness probe checks the dependencies as well, the node should not get
+// traffic while they are down, but they might come back on their own.
+type healthHandler struct {
+	hub     *SSEHub
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+func (h *healthHandler) liveness(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, map[string]HealthCheck{"hub": h.hub.HealthCheck})
+}
+
+func (h *healthHandler) readiness(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]HealthCheck{"hub": h.hub.HealthCheck}
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+
+	h.respond(w, r, checks)
+}
+
+// respond runs the checks concurrently and responds with 503 if any of them failed.
+func (h *healthHandler) respond(w http.ResponseWriter, r *http.Request, checks map[string]HealthCheck) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	resp := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			err := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				resp.Checks[name] = err.Error()
+				resp.Status = "unavailable"
+				return
+			}
+			resp.Checks[name] = "ok"
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	sendResponse(w, status, resp)
+}
+
+func newHealthHandler(hub *SSEHub, checks map[string]HealthCheck) *healthHandler {
+	return &healthHandler{hub: hub, checks: checks, timeout: healthCheckTimeout}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+
+	passing := func(ctx context.Context) error { return nil }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     map[string]HealthCheck
+		wantStatus int
+		wantChecks map[string]string
+	}{
+		{
+			name:       "all checks passing",
+			checks:     map[string]HealthCheck{"database": passing, "pubsub": passing},
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]string{"hub": "ok", "database": "ok", "pubsub": "ok"},
+		},
+		{
+			name: "one check failing",
+			checks: map[string]HealthCheck{
+				"database": passing,
+				"pubsub":   func(ctx context.Context) error { return errors.New("connection refused") },
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"hub": "ok", "database": "ok", "pubsub": "connection refused"},
+		},
+		{
+			name:       "slow check timing out",
+			checks:     map[string]HealthCheck{"database": slow},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]string{"hub": "ok", "database": context.DeadlineExceeded.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := newHealthHandler(hub.SSEHub, tt.checks)
+			health.timeout = 100 * time.Millisecond
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			health.readiness(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if elapsed := time.Since(start); elapsed >= time.Second {
+				t.Errorf("readiness took %s, want the checks to time out", elapsed)
+			}
+
+			var resp healthResponse
+			decodeResponse(t, w, tt.wantStatus, &resp)
+
+			wantStatus := "ok"
+			if tt.wantStatus != http.StatusOK {
+				wantStatus = "unavailable"
+			}
+
+			if resp.Status != wantStatus {
+				t.Errorf("status = %q, want %q", resp.Status, wantStatus)
+			}
+
+			if !maps.Equal(resp.Checks, tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", resp.Checks, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestLivenessOnlyChecksHub(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+
+	w := httptest.NewRecorder()
+	newHealthHandler(hub.SSEHub, map[string]HealthCheck{"database": failing}).liveness(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var resp healthResponse
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if want := map[string]string{"hub": "ok"}; !maps.Equal(resp.Checks, want) {
+		t.Errorf("checks = %v, want %v", resp.Checks, want)
+	}
+}
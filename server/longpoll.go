@@ -0,0 +1,313 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/go-kit/kit/metrics"
+	"github.com/iamsayantan/messagerooms"
+)
+
+const (
+	// pollTimeout is how long a poll request waits for events before it returns empty handed.
+	pollTimeout = 25 * time.Second
+
+	// pollSessionTTL is how long a polling connection is kept open without being polled.
+	pollSessionTTL = time.Minute
+)
+
+// ErrInvalidCursor is returned when the poll cursor is not a valid sequence number.
+var ErrInvalidCursor = errors.New("the cursor must be the sequence of the last received event")
+
+// pollSession is a connection served by long polling. The connection is subscribed and receives events like an
+// eventsource connection, the events are kept in the session until the client acknowledges them with the cursor of
+// a later poll, so a poll response lost on the way is delivered again. The session keeps as many events as the send
+// buffer of the connection, and applies the same overflow policy to the events the client does not acknowledge.
+type pollSession struct {
+	conn *messagerooms.EventsourceConnection
+
+	bufferSize     int                         // bufferSize is the maximum number of pending events
+	overflowPolicy messagerooms.OverflowPolicy // overflowPolicy decides what happens when the pending events are too many
+	droppedEvents  metrics.Counter             // droppedEvents counts the events that could not be kept, like the hub does
+
+	mu       sync.Mutex
+	pending  []messagerooms.EventMessage // pending holds the events not acknowledged by the client yet
+	lastPoll time.Time                   // lastPoll is when the client last polled the session
+}
+
+// take acknowledges the events up to the cursor and returns the ones after it. Heartbeats are left out, the client
+// polling is enough to keep the session alive.
+func (ps *pollSession) take(cursor int64) []messagerooms.EventMessage {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	// the acknowledged events are let go first, so that they never take the place of the events still pending.
+	acknowledged := 0
+	for acknowledged < len(ps.pending) && ps.pending[acknowledged].Sequence <= cursor {
+		acknowledged++
+	}
+	ps.pending = ps.pending[acknowledged:]
+
+	for _, evt := range ps.conn.Drain() {
+		if evt.Event != messagerooms.HeartbeatEvent && !ps.keep(evt) {
+			break
+		}
+	}
+
+	events := make([]messagerooms.EventMessage, len(ps.pending))
+	copy(events, ps.pending)
+	return events
+}
+
+// keep adds the event to the pending ones, applying the overflow policy when there are too many of them already. It
+// returns false once the connection is disconnected for overflowing, the client has to start over then. The lock must
+// be held.
+func (ps *pollSession) keep(evt messagerooms.EventMessage) bool {
+	if len(ps.pending) >= ps.bufferSize {
+		switch ps.overflowPolicy {
+		case messagerooms.OverflowDisconnect:
+			ps.conn.Disconnect(messagerooms.ErrConnectionOverflow)
+			ps.droppedEvents.With("reason", dropReasonDisconnect, "topic", topicLabel(evt)).Add(1)
+			return false
+		case messagerooms.OverflowCoalesce:
+			if evt.CoalesceKey != "" {
+				for i := range ps.pending {
+					if ps.pending[i].CoalesceKey == evt.CoalesceKey {
+						// the event takes the place of the pending one, keeping the sequence in order.
+						evt.Sequence = ps.pending[i].Sequence
+						ps.pending[i] = evt
+						ps.droppedEvents.With("reason", dropReasonCoalesced, "topic", topicLabel(evt)).Add(1)
+						return true
+					}
+				}
+			}
+			fallthrough
+		default:
+			ps.droppedEvents.With("reason", dropReasonDropped, "topic", topicLabel(ps.pending[0])).Add(1)
+			ps.pending = ps.pending[1:]
+		}
+	}
+
+	ps.pending = append(ps.pending, evt)
+	return true
+}
+
+func (ps *pollSession) touch() {
+	ps.mu.Lock()
+	ps.lastPoll = time.Now()
+	ps.mu.Unlock()
+}
+
+func (ps *pollSession) idleSince(t time.Time) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.lastPoll.Before(t)
+}
+
+// pollResponse is the batch of events returned to a poll request. The events have the same envelope as the ones
+// sent over the eventsource connections.
+type pollResponse struct {
+	ConnectionID string                      `json:"connection_id"`
+	Cursor       int64                       `json:"cursor"` // Cursor is the sequence of the last event, to be sent with the next poll
+	Events       []messagerooms.EventMessage `json:"events"`
+	Closed       bool                        `json:"closed"`           // Closed is set when the server closed the connection, the client must start over
+	Reason       string                      `json:"reason,omitempty"` // Reason the connection was closed
+}
+
+// HandlePoll serves the clients that can not keep an eventsource connection open. The first poll, without a
+// connection id, opens a polling connection, and the ClientConnection event carries its id like it does for the
+// eventsource connections. Each poll returns the events after the cursor as soon as there are any, or an empty batch
+// after the poll timeout.
+func (s *SSEHub) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authUser, ok := ctx.Value(KeyAuthUser).(*messagerooms.User)
+	if !ok {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("could not get user")))
+		return
+	}
+
+	var cursor int64
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		var err error
+		if cursor, err = strconv.ParseInt(c, 10, 64); err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidCursor))
+			return
+		}
+	}
+
+	session, err := s.pollSession(r, authUser)
+	if err != nil {
+		switch err {
+		case ErrConnectionNotFound:
+			_ = render.Render(w, r, ErrNotFound(err))
+		case messagerooms.ErrUserConnectionLimit:
+			rejectConnection(w, r, err)
+		default:
+			_ = render.Render(w, r, ErrServiceUnavailable(err))
+		}
+		return
+	}
+
+	session.touch()
+	defer session.touch()
+
+	timer := time.NewTimer(pollTimeout)
+	defer timer.Stop()
+
+	for {
+		events := session.take(cursor)
+
+		select {
+		case <-session.conn.Done():
+			// the events queued before the connection was closed might have missed the take above.
+			events = session.take(cursor)
+			if cursor == 0 && len(events) == 0 && rejectConnection(w, r, session.conn.Err()) {
+				s.closePollSession(session)
+				return
+			}
+
+			s.closePollSession(session)
+			s.sendPollResponse(w, session, cursor, events, session.conn.Err())
+			return
+		default:
+		}
+
+		if len(events) > 0 {
+			s.sendPollResponse(w, session, cursor, events, nil)
+			return
+		}
+
+		select {
+		case <-session.conn.Ready():
+		case <-session.conn.Done():
+		case <-timer.C:
+			s.sendPollResponse(w, session, cursor, nil, nil)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pollSession returns the session of the connection polled by the request, opening a new one if the request does
+// not name a connection. ErrUserConnectionLimit is returned when the user can not open one more connection.
+func (s *SSEHub) pollSession(r *http.Request, user *messagerooms.User) (*pollSession, error) {
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID != "" {
+		s.mu.Lock()
+		session, ok := s.pollSessions[connectionID]
+		s.mu.Unlock()
+
+		if !ok || session.conn.User.ID != user.ID {
+			return nil, ErrConnectionNotFound
+		}
+
+		return session, nil
+	}
+
+	if err := s.checkUserConnectionLimit(r.Context(), user); err != nil {
+		return nil, err
+	}
+
+	conn := messagerooms.NewEventsourceConnection(user, s.config.SendBufferSize, s.config.OverflowPolicy)
+	conn.UserAgent = r.UserAgent()
+	session := &pollSession{
+		conn:           conn,
+		bufferSize:     max(s.config.SendBufferSize, 1),
+		overflowPolicy: s.config.OverflowPolicy,
+		droppedEvents:  s.config.DroppedEvents,
+		lastPoll:       time.Now(),
+	}
+
+	s.mu.Lock()
+	s.pollSessions[conn.ConnectionID] = session
+	s.mu.Unlock()
+
+	select {
+	case s.NewConnection <- conn:
+	case <-s.quit:
+		s.mu.Lock()
+		delete(s.pollSessions, conn.ConnectionID)
+		s.mu.Unlock()
+		return nil, ErrHubClosed
+	}
+
+	return session, nil
+}
+
+// closePollSession forgets the session and lets the hub clean its connection up.
+func (s *SSEHub) closePollSession(session *pollSession) {
+	s.mu.Lock()
+	_, ok := s.pollSessions[session.conn.ConnectionID]
+	delete(s.pollSessions, session.conn.ConnectionID)
+	s.mu.Unlock()
+
+	// concurrent polls of the same session close it only once.
+	if !ok {
+		return
+	}
+
+	select {
+	case s.CloseConnection <- session.conn:
+	case <-s.quit:
+	}
+}
+
+// expirePollSessions periodically closes the polling connections the clients stopped polling.
+func (s *SSEHub) expirePollSessions() {
+	ticker := time.NewTicker(pollSessionTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(-pollSessionTTL)
+
+			s.mu.Lock()
+			var expired []*pollSession
+			for _, session := range s.pollSessions {
+				if session.idleSince(deadline) {
+					expired = append(expired, session)
+				}
+			}
+			s.mu.Unlock()
+
+			for _, session := range expired {
+				s.config.Logger.Info("polling connection expired", "connection_id", session.conn.ConnectionID)
+				s.closePollSession(session)
+			}
+		}
+	}
+}
+
+func (s *SSEHub) sendPollResponse(w http.ResponseWriter, session *pollSession, cursor int64, events []messagerooms.EventMessage, reason error) {
+	if events == nil {
+		events = []messagerooms.EventMessage{}
+	}
+
+	if len(events) > 0 {
+		cursor = events[len(events)-1].Sequence
+	}
+
+	resp := pollResponse{
+		ConnectionID: session.conn.ConnectionID,
+		Cursor:       cursor,
+		Events:       events,
+	}
+
+	if reason != nil {
+		resp.Closed = true
+		resp.Reason = reason.Error()
+	}
+
+	sendResponse(w, http.StatusOK, resp)
+	s.recordDelivered(events)
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+// poll polls the hub as the user with the query, and returns the response after checking its status.
+func poll(t *testing.T, hub *testHub, user *messagerooms.User, query url.Values, status int) pollResponse {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	hub.HandlePoll(w, request(t, http.MethodGet, "/poll?"+query.Encode(), user, nil))
+
+	var resp pollResponse
+	if status != http.StatusOK {
+		decodeResponse(t, w, status, nil)
+		return resp
+	}
+
+	decodeResponse(t, w, status, &resp)
+	return resp
+}
+
+// openPoll opens a polling connection of the user, and returns the first poll response.
+func openPoll(t *testing.T, hub *testHub, user *messagerooms.User) pollResponse {
+	t.Helper()
+
+	resp := poll(t, hub, user, nil, http.StatusOK)
+	if len(resp.Events) != 1 || resp.Events[0].Event != messagerooms.ConnectionEvent {
+		t.Fatalf("first poll events = %+v, want the connection event", resp.Events)
+	}
+
+	return resp
+}
+
+// publishRoom publishes a new room of the user, which is delivered to all the user's connections.
+func publishRoom(t *testing.T, hub *testHub, user *messagerooms.User, roomID string) {
+	t.Helper()
+
+	room := messagerooms.Room{ID: roomID, RoomName: roomID, UserID: user.ID}
+	if err := hub.pubsub.Publish(t.Context(), &messagerooms.RoomCreatedEvent{Room: room}); err != nil {
+		t.Fatalf("publishing room: %v", err)
+	}
+}
+
+func pollQuery(connectionID string, cursor int64) url.Values {
+	return url.Values{"connection_id": {connectionID}, "cursor": {strconv.FormatInt(cursor, 10)}}
+}
+
+func TestPollRedeliversUnacknowledgedEvents(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+	opened := openPoll(t, hub, alice)
+	publishRoom(t, hub, alice, "room-1")
+
+	first := poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusOK)
+	if len(first.Events) != 1 || first.Events[0].Event != messagerooms.RoomCreatedServerEvent {
+		t.Fatalf("poll events = %+v, want the room_created event", first.Events)
+	}
+
+	if first.Cursor != first.Events[0].Sequence {
+		t.Errorf("cursor = %d, want the sequence of the last event %d", first.Cursor, first.Events[0].Sequence)
+	}
+
+	// the response was lost, the client polls again with the same cursor.
+	again := poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusOK)
+	if len(again.Events) != 1 || again.Events[0].Sequence != first.Events[0].Sequence {
+		t.Fatalf("repeated poll events = %+v, want the unacknowledged event again", again.Events)
+	}
+
+	// acknowledging the event leaves the later ones only.
+	publishRoom(t, hub, alice, "room-2")
+	next := poll(t, hub, alice, pollQuery(opened.ConnectionID, first.Cursor), http.StatusOK)
+	if len(next.Events) != 1 || next.Events[0].Sequence <= first.Cursor {
+		t.Fatalf("poll events after acknowledging = %+v, want the second room only", next.Events)
+	}
+
+	// a stale cursor does not bring the acknowledged events back.
+	publishRoom(t, hub, alice, "room-3")
+	stale := poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusOK)
+	if len(stale.Events) != 2 || stale.Events[0].Sequence != next.Events[0].Sequence {
+		t.Fatalf("poll events with a stale cursor = %+v, want the unacknowledged rooms", stale.Events)
+	}
+}
+
+func TestPollInvalidRequests(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+	bob := &messagerooms.User{ID: "bob", Nickname: "bob"}
+
+	opened := openPoll(t, hub, alice)
+
+	poll(t, hub, alice, url.Values{"connection_id": {opened.ConnectionID}, "cursor": {"latest"}}, http.StatusBadRequest)
+	poll(t, hub, alice, pollQuery("unknown", 0), http.StatusNotFound)
+	poll(t, hub, bob, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusNotFound)
+}
+
+func TestPollClosedConnection(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+	opened := openPoll(t, hub, alice)
+	publishRoom(t, hub, alice, "room-1")
+
+	hub.mu.Lock()
+	session := hub.pollSessions[opened.ConnectionID]
+	hub.mu.Unlock()
+	session.conn.Disconnect(messagerooms.ErrConnectionOverflow)
+
+	resp := poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusOK)
+	if !resp.Closed || resp.Reason != messagerooms.ErrConnectionOverflow.Error() {
+		t.Errorf("closed, reason = %v, %q, want the connection closed for %q", resp.Closed, resp.Reason, messagerooms.ErrConnectionOverflow)
+	}
+
+	// the events queued before the connection was closed are still delivered.
+	if len(resp.Events) != 1 || resp.Events[0].Event != messagerooms.RoomCreatedServerEvent {
+		t.Errorf("events of the closed connection = %+v, want the room_created event", resp.Events)
+	}
+
+	poll(t, hub, alice, pollQuery(opened.ConnectionID, resp.Cursor), http.StatusNotFound)
+}
+
+func TestCloseHubWithIdlePollingConnection(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+	opened := openPoll(t, hub, alice)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	if err := hub.Close(ctx); err != nil {
+		t.Fatalf("closing hub: %v", err)
+	}
+
+	if hub.registry.connectionCount() != 0 {
+		t.Error("polling connection is still registered after closing the hub")
+	}
+
+	poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusNotFound)
+}
+
+func TestPollPendingEventsOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     messagerooms.OverflowPolicy
+		wantSeq    []int64
+		wantClosed bool
+	}{
+		{name: "drop oldest", policy: messagerooms.OverflowDropOldest, wantSeq: []int64{3, 4}},
+		{name: "disconnect", policy: messagerooms.OverflowDisconnect, wantSeq: []int64{2, 3}, wantClosed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := newTestHub(t, HubConfig{SendBufferSize: 2, OverflowPolicy: tt.policy})
+			alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+			// the client never acknowledges the events, each poll takes the new one in the pending events.
+			opened := openPoll(t, hub, alice)
+			var resp pollResponse
+			for _, roomID := range []string{"room-1", "room-2", "room-3"} {
+				publishRoom(t, hub, alice, roomID)
+				resp = poll(t, hub, alice, pollQuery(opened.ConnectionID, opened.Cursor), http.StatusOK)
+			}
+
+			var sequences []int64
+			for _, evt := range resp.Events {
+				sequences = append(sequences, evt.Sequence)
+			}
+
+			if !slices.Equal(sequences, tt.wantSeq) {
+				t.Errorf("pending events = %v, want %v", sequences, tt.wantSeq)
+			}
+
+			if resp.Closed != tt.wantClosed {
+				t.Errorf("closed = %v (%q), want %v", resp.Closed, resp.Reason, tt.wantClosed)
+			}
+
+			if tt.wantClosed {
+				if resp.Reason != messagerooms.ErrConnectionOverflow.Error() {
+					t.Errorf("reason = %q, want %q", resp.Reason, messagerooms.ErrConnectionOverflow)
+				}
+
+				poll(t, hub, alice, pollQuery(opened.ConnectionID, resp.Cursor), http.StatusNotFound)
+			}
+		})
+	}
+}
@@ -3,10 +3,23 @@ package server
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi"
+	chiware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/go-kit/kit/metrics"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/iamsayantan/messagerooms"
 	"github.com/iamsayantan/messagerooms/user"
 )
 
@@ -47,7 +60,12 @@ func (am *authMiddleware) Register(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := am.us.VerifyAuthToken(token)
+		user, err := am.us.VerifyAuthToken(r.Context(), token)
+		if errors.Is(err, messagerooms.ErrUnavailable) {
+			_ = render.Render(w, r, ErrFromService(err))
+			return
+		}
+
 		if err != nil {
 			_ = render.Render(w, r, ErrUnAuthorized(err))
 			return
@@ -63,3 +81,191 @@ func (am *authMiddleware) Register(next http.Handler) http.Handler {
 func newAuthMiddleware(us user.Service) Middleware {
 	return &authMiddleware{us: us}
 }
+
+// ====================================================//
+//               Request ID Middleware.                //
+//=====================================================//
+
+const (
+	// RequestIDHeader carries the id of the request, it is taken from the client if set and returned in the response.
+	RequestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength is the longest request id accepted from the client.
+	maxRequestIDLength = 128
+)
+
+type requestIDMiddleware struct{}
+
+func (rm *requestIDMiddleware) Register(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = uuid.NewV4().String()
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx := messagerooms.WithRequestID(r.Context(), requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newRequestIDMiddleware() Middleware {
+	return &requestIDMiddleware{}
+}
+
+// ====================================================//
+//               Access Log Middleware.                //
+//=====================================================//
+
+type accessLogMiddleware struct {
+	logger *slog.Logger
+}
+
+func (lm *accessLogMiddleware) Register(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// the wrapped writer still flushes, the eventsource connections depend on it.
+		ww := chiware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func(begin time.Time) {
+			lm.logger.InfoContext(
+				r.Context(),
+				"http request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", ww.Status(),
+				"bytes", ww.BytesWritten(),
+				"took", time.Since(begin),
+			)
+		}(time.Now())
+
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newAccessLogMiddleware(logger *slog.Logger) Middleware {
+	return &accessLogMiddleware{logger: logger}
+}
+
+// ====================================================//
+//               Tracing Middleware.                   //
+//=====================================================//
+
+type tracingMiddleware struct {
+	tracer trace.Tracer
+}
+
+func (tm *tracingMiddleware) Register(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// the request continues the trace of the client, if it sent one.
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tm.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+				attribute.String("request_id", messagerooms.RequestIDFromContext(ctx)),
+			),
+		)
+		defer span.End()
+
+		ww := chiware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		// the route is only known once the router has matched it.
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newTracingMiddleware(tracer trace.Tracer) Middleware {
+	return &tracingMiddleware{tracer: tracer}
+}
+
+// ====================================================//
+//               Metrics Middleware.                   //
+//=====================================================//
+
+// unmatchedRoute labels the requests that did not match any route, so that unknown paths don't add labels.
+const unmatchedRoute = "unmatched"
+
+// metricsMiddleware counts the requests and observes their latency, labelled by method, route and status. The route
+// is the pattern the request matched rather than its path, so the ids in the paths don't add labels.
+type metricsMiddleware struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+}
+
+func (mm *metricsMiddleware) Register(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ww := chiware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func(begin time.Time) {
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			lvs := []string{"method", r.Method, "route", route, "status", strconv.Itoa(status)}
+			mm.requestCount.With(lvs...).Add(1)
+			mm.requestLatency.With(lvs...).Observe(time.Since(begin).Seconds())
+		}(time.Now())
+
+		next.ServeHTTP(ww, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newMetricsMiddleware(requestCount metrics.Counter, requestLatency metrics.Histogram) Middleware {
+	return &metricsMiddleware{requestCount: requestCount, requestLatency: requestLatency}
+}
+
+// ====================================================//
+//               Timeout Middleware.                   //
+//=====================================================//
+
+// DefaultRequestTimeout is how long a request may run when no timeout is configured.
+const DefaultRequestTimeout = 10 * time.Second
+
+// timeoutMiddleware bounds the context of the request, the storage queries still running when it expires are
+// cancelled. It must not wrap the streaming endpoints, they are expected to stay open.
+type timeoutMiddleware struct {
+	timeout time.Duration
+}
+
+func (tm *timeoutMiddleware) Register(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), tm.timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
+
+func newTimeoutMiddleware(timeout time.Duration) Middleware {
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	return &timeoutMiddleware{timeout: timeout}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+// fakeCounter records the label values of every addition, the counters returned by With share the records.
+type fakeCounter struct {
+	lvs     []string
+	mu      *sync.Mutex
+	records *[]string
+}
+
+func newFakeCounter() fakeCounter {
+	return fakeCounter{mu: &sync.Mutex{}, records: &[]string{}}
+}
+
+func (c fakeCounter) With(lvs ...string) metrics.Counter {
+	return fakeCounter{lvs: append(slices.Clone(c.lvs), lvs...), mu: c.mu, records: c.records}
+}
+
+func (c fakeCounter) Add(delta float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.records = append(*c.records, strings.Join(c.lvs, " "))
+}
+
+func (c fakeCounter) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(*c.records)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	requestCount := newFakeCounter()
+
+	r := chi.NewRouter()
+	r.Use(newMetricsMiddleware(requestCount, discard.NewHistogram()).Register)
+	r.Route("/rooms", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			sendResponse(w, http.StatusNotFound, nil)
+		})
+		r.Post("/{id}/join", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("{}"))
+		})
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/rooms/room-1", nil),
+		httptest.NewRequest(http.MethodPost, "/rooms/room-1/join", nil),
+		httptest.NewRequest(http.MethodGet, "/unknown/room-1", nil),
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []string{
+		"method GET route /rooms/{id} status 404",
+		"method POST route /rooms/{id}/join status 200",
+		"method GET route unmatched status 404",
+	}
+	if got := requestCount.recorded(); !slices.Equal(got, want) {
+		t.Errorf("recorded requests = %q, want %q", got, want)
+	}
+}
@@ -1,29 +1,113 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-chi/render"
-	"github.com/gomodule/redigo/redis"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	"github.com/iamsayantan/messagerooms"
 	"github.com/iamsayantan/messagerooms/pubsub"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+const (
+	// pubsubTimeout is the time a connection waits for the pubsub system while it is (un)subscribed.
+	pubsubTimeout = 5 * time.Second
+
+	// defaultReconnectDelay is suggested to the clients when the hub closes and no delay is configured.
+	defaultReconnectDelay = 2 * time.Second
+
+	// maxConnectionSubscriptions is the number of topics a client can subscribe its connection to, on top of the
+	// personal topics.
+	maxConnectionSubscriptions = 100
+)
+
+var (
+	// ErrHubClosed is returned when a client tries to connect to a closed hub.
+	ErrHubClosed = errors.New("server is shutting down, reconnect later")
+
+	// ErrConnectionNotFound is returned when the connection is not open on this server or belongs to another user.
+	ErrConnectionNotFound = errors.New("connection not found")
+
+	// ErrTooManySubscriptions is returned when a client tries to subscribe its connection to more topics than allowed.
+	ErrTooManySubscriptions = errors.New("too many subscriptions for the connection")
+
+	// ErrHubNotReceiving is returned by the health check once the hub stopped receiving events from the pubsub system.
+	ErrHubNotReceiving = errors.New("hub stopped receiving events")
+
+	// ErrHubUnresponsive is returned by the health check when the hub does not handle the connections anymore.
+	ErrHubUnresponsive = errors.New("hub is not responding")
+)
+
+// Labels of the dropped events counter, telling why an event was dropped.
+const (
+	dropReasonDropped    = "dropped"
+	dropReasonCoalesced  = "coalesced"
+	dropReasonDisconnect = "disconnected"
+)
+
+// HubConfig holds the options for the SSEHub.
+type HubConfig struct {
+	SendBufferSize int                         // SendBufferSize is the number of events queued per connection
+	OverflowPolicy messagerooms.OverflowPolicy // OverflowPolicy is applied when an event is sent to a connection with a full buffer
+
+	DroppedEvents   metrics.Counter   // DroppedEvents counts the events that could not be queued, labelled by reason and topic
+	DeliveredEvents metrics.Counter   // DeliveredEvents counts the events written to the clients, labelled by topic
+	QueueDepth      metrics.Histogram // QueueDepth observes the depth of a connection's send queue whenever an event is queued
+	OpenConnections metrics.Gauge     // OpenConnections is the number of connections open on the node, labelled by node
+
+	// PublishLatency observes the seconds between the creation of a published event and its arrival to the hub. The
+	// event might be created on another node, so the clocks of the nodes need to be in sync.
+	PublishLatency metrics.Histogram
+
+	// FlushLatency observes the seconds between queueing an event for a connection and flushing it to the client.
+	FlushLatency metrics.Histogram
+
+	Logger *slog.Logger // Logger is used by the hub and the connection handlers, the default logger is used if nil
+	Tracer trace.Tracer // Tracer traces the delivery of the published events to the connections, nothing is traced if nil
+
+	NodeID                string // NodeID identifies this server among the nodes, connections are reported with it
+	MaxConnectionsPerUser int    // MaxConnectionsPerUser limits the connections of a user across all the nodes, zero means no limit
+	MaxConnectionsPerNode int    // MaxConnectionsPerNode limits the connections open on this node, zero means no limit
+
+	// ReconnectDelay is the minimum delay suggested to the clients for reconnecting when the hub closes. A random
+	// jitter up to the same duration is added so that the clients don't all reconnect at once.
+	ReconnectDelay time.Duration
+}
+
 // SSEHub maintains persistent eventsource connection to server.
 type SSEHub struct {
 	mu              sync.Mutex
-	NewConnection   chan messagerooms.EventsourceConnection       // NewConnection is the channel for any new client connection
-	CloseConnection chan messagerooms.EventsourceConnection       // CloseConnection is channel for any closing connection
-	OpenConnections map[string]messagerooms.EventsourceConnection // OpenConnections holds all the active open connections to the server
+	NewConnection   chan *messagerooms.EventsourceConnection       // NewConnection is the channel for any new client connection
+	CloseConnection chan *messagerooms.EventsourceConnection       // CloseConnection is channel for any closing connection
+	OpenConnections map[string]*messagerooms.EventsourceConnection // OpenConnections holds all the active open connections to the server
+
+	pollSessions map[string]*pollSession // pollSessions holds the connections served by long polling, keyed by connection id
 
+	config     HubConfig
 	pubsub     pubsub.Service
-	pubsubConn *redis.PubSubConn
+	subscriber pubsub.Subscriber
+	registry   pubsub.ConnectionRegistry
+
+	closed    bool          // closed is set once the hub starts closing, no new connections are accepted afterwards
+	settling  int           // settling counts the connections whose registration and subscriptions are not cleaned up yet
+	drained   chan struct{} // drained is closed when the hub is closed and all the connections are cleaned up
+	quit      chan struct{} // quit is closed to stop the hub goroutines
+	receiving chan struct{} // receiving is closed when the hub stops receiving events from the pubsub system
+	probe     chan struct{} // probe is received by the hub goroutine, the health check uses it to tell it is alive
 }
 
 // HandleSSE handles incoming persistent connection.
@@ -45,41 +129,117 @@ func (s *SSEHub) HandleSSE(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.checkUserConnectionLimit(ctx, authUser); err != nil {
+		rejectConnection(w, r, err)
+		return
+	}
+
 	// Set the headers related to event streaming.
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // See https://stackoverflow.com/a/33414096/6662819
+	w.Header().Set("X-Accel-Buffering", "no")          // See https://stackoverflow.com/a/33414096/6662819
 	w.Header().Set("Access-Control-Allow-Origin", "*") // for now allowing cross origin requests.
 
-	eventSourceConn := messagerooms.NewEventsourceConnection(authUser)
+	eventSourceConn := messagerooms.NewEventsourceConnection(authUser, s.config.SendBufferSize, s.config.OverflowPolicy)
+	eventSourceConn.UserAgent = r.UserAgent()
 
 	// Signal the SSEHub that we have a new client connection.
-	s.NewConnection <- *eventSourceConn
+	select {
+	case s.NewConnection <- eventSourceConn:
+	case <-s.quit:
+		_ = render.Render(w, r, ErrServiceUnavailable(ErrHubClosed))
+		return
+	}
 
 	// We need to notify the hub if somehow the connection dies and the handler exits.
 	defer func() {
-		log.Printf("Connection interrupted: %s", eventSourceConn.ConnectionID)
-		s.CloseConnection <- *eventSourceConn
-	}()
-
-	// If the client closes the connection, we receive that in ctx.Done() channel for which we need to listen
-	// and inform the hub about the event.
-	go func() {
-		<-ctx.Done()
-		s.CloseConnection <- *eventSourceConn
-		log.Printf("Connection closed by client: %s", eventSourceConn.ConnectionID)
+		select {
+		case s.CloseConnection <- eventSourceConn:
+		case <-s.quit:
+		}
 	}()
 
-	// block waiting for messages broadcast on this connection's SendCh
+	// block waiting for events queued for this connection, writing all the pending events before flushing. If the
+	// client closes the connection we receive that in ctx.Done() channel. The server may disconnect the connection
+	// as well, if the client is too slow to keep up with its events or the server is shutting down.
+	streaming := false
 	for {
-		evt := <-eventSourceConn.SendCh
-		//log.Printf("Got event for connectionID: %s Event:\n%s", evt.DestinationID, evt.String())
-		_, _ = fmt.Fprintf(w, evt.String())
-		flusher.Flush()
+		select {
+		case <-eventSourceConn.Ready():
+			s.writeEvents(w, flusher, eventSourceConn.Drain())
+			streaming = true
+		case <-eventSourceConn.Done():
+			// a connection rejected by the hub has not started streaming yet, so the client gets a proper error.
+			if !streaming && rejectConnection(w, r, eventSourceConn.Err()) {
+				s.config.Logger.InfoContext(ctx, "connection rejected", "connection_id", eventSourceConn.ConnectionID, "reason", eventSourceConn.Err())
+				return
+			}
+
+			// events queued before the disconnect, like the reconnect hint, are still sent.
+			s.writeEvents(w, flusher, eventSourceConn.Drain())
+			s.config.Logger.InfoContext(ctx, "connection disconnected", "connection_id", eventSourceConn.ConnectionID, "reason", eventSourceConn.Err())
+			return
+		case <-ctx.Done():
+			s.config.Logger.InfoContext(ctx, "connection closed by client", "connection_id", eventSourceConn.ConnectionID)
+			return
+		}
 	}
 }
 
+// rejectConnection renders the error response for a connection rejected because of the connection limits, it
+// returns false if the connection was not rejected for that.
+func rejectConnection(w http.ResponseWriter, r *http.Request, reason error) bool {
+	switch reason {
+	case messagerooms.ErrUserConnectionLimit:
+		_ = render.Render(w, r, ErrTooManyRequests(reason))
+	case messagerooms.ErrNodeConnectionLimit:
+		_ = render.Render(w, r, ErrServiceUnavailable(reason))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// writeEvents writes the events to the eventsource connection and flushes them to the client.
+func (s *SSEHub) writeEvents(w http.ResponseWriter, flusher http.Flusher, events []messagerooms.EventMessage) {
+	for _, evt := range events {
+		_, _ = fmt.Fprint(w, evt.String())
+	}
+	flusher.Flush()
+
+	s.recordDelivered(events)
+}
+
+// recordDelivered records the events flushed to a client. The events published for a request are logged with its
+// request id, so that they can be traced from the request to the client.
+func (s *SSEHub) recordDelivered(events []messagerooms.EventMessage) {
+	now := time.Now()
+	for _, evt := range events {
+		if published, ok := evt.Data.(*messagerooms.PublishEvent); ok {
+			s.config.Logger.Debug("event flushed", "connection_id", evt.DestinationID, "event", evt.Event,
+				"topic", published.Topic, "request_id", published.RequestID)
+		}
+
+		s.config.DeliveredEvents.With("topic", topicLabel(evt)).Add(1)
+		if !evt.QueuedAt.IsZero() {
+			s.config.FlushLatency.Observe(now.Sub(evt.QueuedAt).Seconds())
+		}
+	}
+}
+
+// topicLabel returns the name of the event's topic without the identifier, so that the metrics are not labelled per
+// user or room. The events generated by the hub itself are labelled with their event name.
+func topicLabel(evt messagerooms.EventMessage) string {
+	published, ok := evt.Data.(*messagerooms.PublishEvent)
+	if !ok {
+		return string(evt.Event)
+	}
+
+	return strings.SplitN(published.Topic, ":", 2)[0]
+}
+
 // Listen spawns a goroutine that listens for any incoming or closing client connections.
 func (s *SSEHub) Listen() {
 	go func() {
@@ -89,19 +249,68 @@ func (s *SSEHub) Listen() {
 				s.handleNewConnection(sseConn)
 			case sseConn := <-s.CloseConnection:
 				s.handleClosingConnection(sseConn)
+			case <-s.probe:
+			case <-s.quit:
+				return
 			}
 		}
 	}()
 }
 
 // handleNewConnection handles new incoming eventsource connection. It adds the new connection to the hubs opened
-// connection map and registers heartbeat events for that particular connection. We also add the connection identifier
-// to the users personal topics.
-func (s *SSEHub) handleNewConnection(sseConn messagerooms.EventsourceConnection) {
+// connection map and hands it over to its own goroutine, which registers it and subscribes it to the users personal
+// topics, so that the hub goroutine never waits for the registry nor the pubsub system. Connections exceeding the per
+// node limit are rejected, the per user limit is checked by the handlers beforehand since it takes a round trip to the
+// registry.
+func (s *SSEHub) handleNewConnection(sseConn *messagerooms.EventsourceConnection) {
 	s.mu.Lock()
-	s.OpenConnections[sseConn.ConnectionID] = sseConn
+	closed := s.closed
+	nodeFull := s.config.MaxConnectionsPerNode > 0 && len(s.OpenConnections) >= s.config.MaxConnectionsPerNode
+	if !closed && !nodeFull {
+		s.OpenConnections[sseConn.ConnectionID] = sseConn
+		s.settling++
+		s.config.OpenConnections.With("node", s.config.NodeID).Set(float64(len(s.OpenConnections)))
+	}
 	s.mu.Unlock()
 
+	// the hub started closing while the connection was on its way, it is sent away right away.
+	if closed {
+		s.shutdownConnection(sseConn)
+		return
+	}
+
+	if nodeFull {
+		sseConn.Disconnect(messagerooms.ErrNodeConnectionLimit)
+		return
+	}
+
+	go s.serveConnection(sseConn)
+}
+
+// serveConnection registers the connection and subscribes it to the personal topics of the user, then cleans them up
+// once the connection is closed. The connection event is sent once the connection is subscribed, so the client
+// receives the events published from then on.
+func (s *SSEHub) serveConnection(sseConn *messagerooms.EventsourceConnection) {
+	defer func() {
+		s.mu.Lock()
+		s.settling--
+		s.checkDrained()
+		s.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), pubsubTimeout)
+	defer cancel()
+
+	if err := s.registry.Register(ctx, s.connectionInfo(sseConn)); err != nil {
+		s.config.Logger.Error("registering connection", "connection_id", sseConn.ConnectionID, "err", err)
+	}
+
+	// the control topic lets the other nodes reach the connection, for example to terminate it.
+	topics := append(sseConn.User.GetPersonalTopics(), sseConn.ControlTopic())
+	if err := s.pubsub.Subscribe(ctx, sseConn.ConnectionID, topics...); err != nil {
+		s.config.Logger.Error("subscribing connection to personal topics", "connection_id", sseConn.ConnectionID, "err", err)
+	}
+
 	// send an initial event with the connection id
 	connectionEvt := struct {
 		ConnectionID string `json:"connection_id"`
@@ -112,90 +321,461 @@ func (s *SSEHub) handleNewConnection(sseConn messagerooms.EventsourceConnection)
 	}
 
 	msg := messagerooms.EventMessage{Event: messagerooms.ConnectionEvent, DestinationID: sseConn.ConnectionID, Data: connectionEvt}
-	sseConn.PublishEvent(msg)
-	sseConn.Heartbeat()
+	s.send(sseConn, msg)
+	sseConn.Heartbeat(func(evt messagerooms.EventMessage) {
+		s.send(sseConn, evt)
+	})
 
-	for _, topic := range sseConn.User.GetPersonalTopics() {
-		s.pubsub.Subscribe(topic, sseConn.ConnectionID)
-	}
+	s.config.Logger.Info("client connected", "connection_id", sseConn.ConnectionID, "user_id", sseConn.User.ID)
 
-	log.Printf("New client connected. ConnectionID: %s Number of registered clients %d", sseConn.ConnectionID, len(s.OpenConnections))
+	<-sseConn.Closed()
+	s.cleanUpConnection(sseConn)
 }
 
-// handleClosingConnection does the cleaning up after a client disconnects from the server.
-func (s *SSEHub) handleClosingConnection(sseConn messagerooms.EventsourceConnection) {
+// handleClosingConnection forgets the connection after a client disconnects from the server, its goroutine cleans
+// it up.
+func (s *SSEHub) handleClosingConnection(sseConn *messagerooms.EventsourceConnection) {
 	s.mu.Lock()
 	delete(s.OpenConnections, sseConn.ConnectionID)
+	s.config.OpenConnections.With("node", s.config.NodeID).Set(float64(len(s.OpenConnections)))
 	s.mu.Unlock()
 
+	// the goroutine of the connection cleans it up once it's closing, a rejected connection has none.
 	sseConn.Closing()
+}
 
+// cleanUpConnection unsubscribes the closed connection from its topics and deregisters it.
+func (s *SSEHub) cleanUpConnection(sseConn *messagerooms.EventsourceConnection) {
 	// as we are subscribing the connection to user's personal topics when the connection is first being made, we need to
 	// clear that up when the connection is being closed.
-	for _, topic := range sseConn.User.GetPersonalTopics() {
-		s.pubsub.Unsubscribe(topic, sseConn.ConnectionID)
+	ctx, cancel := context.WithTimeout(context.Background(), pubsubTimeout)
+	defer cancel()
+
+	topics := append(sseConn.User.GetPersonalTopics(), sseConn.ControlTopic())
+	if err := s.pubsub.Unsubscribe(ctx, sseConn.ConnectionID, topics...); err != nil {
+		s.config.Logger.Error("unsubscribing connection from personal topics", "connection_id", sseConn.ConnectionID, "err", err)
+	}
+
+	if err := s.registry.Deregister(ctx, s.connectionInfo(sseConn)); err != nil {
+		s.config.Logger.Error("deregistering connection", "connection_id", sseConn.ConnectionID, "err", err)
+	}
+
+	// the topics the client subscribed the connection to are cleared up as well.
+	if topics := sseConn.Subscriptions(); len(topics) > 0 {
+		if err := s.pubsub.Unsubscribe(ctx, sseConn.ConnectionID, topics...); err != nil {
+			s.config.Logger.Error("unsubscribing connection from client topics", "connection_id", sseConn.ConnectionID, "err", err)
+		}
+	}
+
+	s.config.Logger.Info("client removed", "connection_id", sseConn.ConnectionID, "user_id", sseConn.User.ID)
+}
+
+// SubscribeConnection subscribes an open connection of the user to the topics, so that the connection receives their
+// events until it is closed or unsubscribed. ErrConnectionNotFound is returned if the connection is not open on this
+// server or is not owned by the user.
+func (s *SSEHub) SubscribeConnection(ctx context.Context, connectionID string, user messagerooms.User, topics ...string) error {
+	sseConn, err := s.userConnection(connectionID, user)
+	if err != nil {
+		return err
+	}
+
+	if len(sseConn.Subscriptions())+len(topics) > maxConnectionSubscriptions {
+		return ErrTooManySubscriptions
+	}
+
+	// the topics are recorded before subscribing, so that a connection closing in the meantime unsubscribes them.
+	sseConn.AddSubscriptions(topics...)
+	if err := s.pubsub.Subscribe(ctx, connectionID, topics...); err != nil {
+		return err
+	}
+
+	// the connection might have been cleaned up before the topics were recorded, then it's on us to unsubscribe.
+	if sseConn.IsClosing() {
+		if err := s.pubsub.Unsubscribe(ctx, connectionID, topics...); err != nil {
+			s.config.Logger.ErrorContext(ctx, "unsubscribing closed connection from client topics", "connection_id", connectionID, "err", err)
+		}
+		return ErrConnectionNotFound
+	}
+
+	return nil
+}
+
+// UnsubscribeConnection unsubscribes an open connection of the user from topics it was subscribed to with
+// SubscribeConnection. The personal topics of the user can not be unsubscribed from.
+func (s *SSEHub) UnsubscribeConnection(ctx context.Context, connectionID string, user messagerooms.User, topics ...string) error {
+	sseConn, err := s.userConnection(connectionID, user)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pubsub.Unsubscribe(ctx, connectionID, topics...); err != nil {
+		return err
+	}
+
+	sseConn.RemoveSubscriptions(topics...)
+	return nil
+}
+
+// UserConnections returns the connections of the user open on any node.
+func (s *SSEHub) UserConnections(ctx context.Context, user messagerooms.User) ([]messagerooms.ConnectionInfo, error) {
+	return s.registry.UserConnections(ctx, user.ID)
+}
+
+// TerminateConnection disconnects a connection of the user, on whichever node it is open. ErrConnectionNotFound is
+// returned if the user has no such connection.
+func (s *SSEHub) TerminateConnection(ctx context.Context, connectionID string, user messagerooms.User) error {
+	// a connection open on this node is disconnected right away.
+	if sseConn, err := s.userConnection(connectionID, user); err == nil {
+		s.terminateConnection(sseConn)
+		return nil
+	}
+
+	connections, err := s.registry.UserConnections(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range connections {
+		if info.ConnectionID == connectionID {
+			return s.pubsub.Publish(ctx, &messagerooms.TerminateConnectionEvent{ConnectionID: connectionID})
+		}
+	}
+
+	return ErrConnectionNotFound
+}
+
+// terminateConnection tells the client its connection was terminated, so that it does not reconnect, and
+// disconnects it.
+func (s *SSEHub) terminateConnection(sseConn *messagerooms.EventsourceConnection) {
+	terminatedEvt := struct {
+		Reason string `json:"reason"`
+	}{
+		Reason: messagerooms.ErrConnectionTerminated.Error(),
+	}
+
+	msg := messagerooms.EventMessage{Event: messagerooms.TerminatedEvent, DestinationID: sseConn.ConnectionID, Data: terminatedEvt}
+	s.send(sseConn, msg)
+	sseConn.Disconnect(messagerooms.ErrConnectionTerminated)
+}
+
+// checkUserConnectionLimit returns ErrUserConnectionLimit if the user already has the maximum number of connections
+// open. If the registry can not be reached the connection is allowed, the limit is not worth an outage. It is called
+// by the handlers before the connection is handed to the hub, so the hub goroutine never waits for the registry. The
+// connections opened by a user at the same moment, like the ones opened on several nodes, may exceed the limit
+// slightly.
+func (s *SSEHub) checkUserConnectionLimit(ctx context.Context, user *messagerooms.User) error {
+	if s.config.MaxConnectionsPerUser <= 0 {
+		return nil
 	}
 
-	log.Printf("Removed client. ConnectionID %s Number of registered clients %d", sseConn.ConnectionID, len(s.OpenConnections))
+	ctx, cancel := context.WithTimeout(ctx, pubsubTimeout)
+	defer cancel()
+
+	connections, err := s.registry.UserConnections(ctx, user.ID)
+	if err != nil {
+		s.config.Logger.Error("counting connections of user", "user_id", user.ID, "err", err)
+		return nil
+	}
+
+	if len(connections) >= s.config.MaxConnectionsPerUser {
+		return messagerooms.ErrUserConnectionLimit
+	}
+
+	return nil
+}
+
+// connectionInfo describes the connection for the registry.
+func (s *SSEHub) connectionInfo(sseConn *messagerooms.EventsourceConnection) messagerooms.ConnectionInfo {
+	return messagerooms.ConnectionInfo{
+		ConnectionID: sseConn.ConnectionID,
+		UserID:       sseConn.User.ID,
+		NodeID:       s.config.NodeID,
+		UserAgent:    sseConn.UserAgent,
+		ConnectedAt:  sseConn.ConnectedAt,
+	}
 }
 
-// ReceiveHubEvents spawns a goroutine which listens
+// userConnection returns the open connection with the id if it belongs to the user.
+func (s *SSEHub) userConnection(connectionID string, user messagerooms.User) (*messagerooms.EventsourceConnection, error) {
+	s.mu.Lock()
+	sseConn, ok := s.OpenConnections[connectionID]
+	s.mu.Unlock()
+
+	// other users' connections are reported as missing, so that their ids can not be probed.
+	if !ok || sseConn.User.ID != user.ID {
+		return nil, ErrConnectionNotFound
+	}
+
+	return sseConn, nil
+}
+
+// ReceiveHubEvents spawns a goroutine which listens for the events coming from the pubsub system and
+// delivers them to the open connections.
 func (s *SSEHub) ReceiveHubEvents() {
 	go func() {
-		for {
-			switch v := s.pubsubConn.Receive().(type) {
-			case redis.Message:
-				// We expect that data should be of type PublishEvent. Otherwise its an error and we don't process it.
-				payload := v.Data
-				var eventMessage *messagerooms.PublishEvent
-				if err := json.Unmarshal(payload, &eventMessage); err != nil {
-					log.Printf("Invalid Event Received")
-					break
-				}
-
-				s.publishEventToClient(eventMessage)
-				log.Printf("[Redis Message] Channel: %s, Message: %s\n", v.Channel, string(v.Data))
-			case redis.Subscription:
-				log.Printf("[Redis Subscription] Channel: %s, Kind: %s, Count: %d\n", v.Channel, v.Kind, v.Count)
-			case error:
-				log.Printf("Error pub/sub on connection, delivery has stopped %s\n", v.Error())
-				return
-			}
+		defer close(s.receiving)
+
+		err := s.subscriber.ReceiveEvents(s.publishEventToClient)
+		if err == pubsub.ErrSubscriberClosed {
+			s.config.Logger.Info("stopped receiving hub events")
+			return
 		}
+
+		s.config.Logger.Error("receiving hub events failed, delivery has stopped", "err", err)
 	}()
 }
 
+// HealthCheck reports whether the hub goroutines are alive: the one receiving the events from the pubsub system has
+// not stopped, and the one handling the connections is not stuck.
+func (s *SSEHub) HealthCheck(ctx context.Context) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed {
+		return ErrHubClosed
+	}
+
+	select {
+	case <-s.receiving:
+		return ErrHubNotReceiving
+	default:
+	}
+
+	select {
+	case s.probe <- struct{}{}:
+		return nil
+	case <-s.quit:
+		return ErrHubClosed
+	case <-ctx.Done():
+		return ErrHubUnresponsive
+	}
+}
+
+// Close gracefully shuts the hub down. Every open connection receives a reconnect hint before it is disconnected,
+// and once the connections are unsubscribed from the pubsub system the hub goroutines are stopped. The polling
+// connections are closed right away. Close waits for the connections to be cleaned up until the context is done.
+func (s *SSEHub) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.closed = true
+	connections := make([]*messagerooms.EventsourceConnection, 0, len(s.OpenConnections))
+	for _, sseConn := range s.OpenConnections {
+		connections = append(connections, sseConn)
+	}
+	sessions := make([]*pollSession, 0, len(s.pollSessions))
+	for _, session := range s.pollSessions {
+		sessions = append(sessions, session)
+	}
+	s.checkDrained()
+	s.mu.Unlock()
+
+	s.config.Logger.Info("closing hub", "connections", len(connections))
+	for _, sseConn := range connections {
+		s.shutdownConnection(sseConn)
+	}
+
+	// nobody waits on the idle polling connections to tell the hub they are closed, so they are closed here. A poll in
+	// progress still returns the reconnect hint, the client starts over with the next poll anyway.
+	for _, session := range sessions {
+		s.closePollSession(session)
+	}
+
+	// the handlers inform the hub once their connection is closed, and the hub cleans them up.
+	var err error
+	select {
+	case <-s.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	close(s.quit)
+	if subErr := s.subscriber.Close(); subErr != nil && err == nil {
+		err = subErr
+	}
+
+	// connections that could not be cleaned up in time still need their heartbeats stopped.
+	s.mu.Lock()
+	for _, sseConn := range s.OpenConnections {
+		sseConn.Closing()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.receiving:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// shutdownConnection sends the reconnect hint to the connection and disconnects it.
+func (s *SSEHub) shutdownConnection(sseConn *messagerooms.EventsourceConnection) {
+	delay := s.config.ReconnectDelay + time.Duration(rand.Int63n(int64(s.config.ReconnectDelay)))
+	reconnectEvt := struct {
+		Reason     string `json:"reason"`
+		RetryAfter int64  `json:"retry_after"`
+	}{
+		Reason:     messagerooms.ErrServerShutdown.Error(),
+		RetryAfter: delay.Milliseconds(),
+	}
+
+	msg := messagerooms.EventMessage{
+		Event:         messagerooms.ReconnectEvent,
+		DestinationID: sseConn.ConnectionID,
+		Data:          reconnectEvt,
+		Retry:         delay.Milliseconds(),
+	}
+	s.send(sseConn, msg)
+	sseConn.Disconnect(messagerooms.ErrServerShutdown)
+}
+
+// checkDrained signals that the hub is drained once it is closed and all the connections are cleaned up. It must
+// be called holding the lock.
+func (s *SSEHub) checkDrained() {
+	if !s.closed || len(s.OpenConnections) > 0 || s.settling > 0 {
+		return
+	}
+
+	select {
+	case <-s.drained:
+	default:
+		close(s.drained)
+	}
+}
+
 // publishEventToClient sends the event to the appropriate client over its eventsource connection.
 func (s *SSEHub) publishEventToClient(msg *messagerooms.PublishEvent) {
-	if client, ok := s.OpenConnections[msg.ConnectionID]; ok {
-		event := messagerooms.EventMessage{
-			Event:         messagerooms.MessageRoomEvent,
-			DestinationID: client.ConnectionID,
-			Data:          msg,
-		}
-		client.PublishEvent(event)
+	s.mu.Lock()
+	client, ok := s.OpenConnections[msg.ConnectionID]
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if msg.CreatedAt > 0 {
+		s.config.PublishLatency.Observe(time.Since(time.Unix(0, msg.CreatedAt)).Seconds())
+	}
+
+	// commands for the connection are carried out by the hub instead of being delivered.
+	if msg.Event == messagerooms.TerminateConnectionServerEvent {
+		s.terminateConnection(client)
+		return
 	}
+
+	// events published without declaring their own event, like the ones from nodes running an older version,
+	// are still delivered under the generic event.
+	eventName := msg.Event
+	if eventName == "" {
+		eventName = messagerooms.MessageRoomEvent
+	}
+
+	s.config.Logger.Debug("event received", "connection_id", client.ConnectionID, "event", eventName,
+		"topic", msg.Topic, "request_id", msg.RequestID)
+
+	// the delivery continues the trace of the request that published the event.
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(msg.TraceContext))
+	_, span := s.config.Tracer.Start(ctx, "sse.Deliver",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.message.event", string(eventName)),
+			attribute.String("connection_id", client.ConnectionID),
+		),
+	)
+	defer span.End()
+
+	event := messagerooms.EventMessage{
+		Event:         eventName,
+		DestinationID: client.ConnectionID,
+		Data:          msg,
+	}
+	s.send(client, event)
 }
 
-// NewSSEHub returns a new hub instance.
-func NewSSEHub(conn *redis.PubSubConn, pubsub pubsub.Service) *SSEHub {
-	sseHub := &SSEHub{
-		NewConnection:   make(chan messagerooms.EventsourceConnection),
-		CloseConnection: make(chan messagerooms.EventsourceConnection),
-		OpenConnections: make(map[string]messagerooms.EventsourceConnection),
-		pubsubConn:      conn,
-		pubsub:          pubsub,
+// send queues the event for the connection and records what happened to it. Queueing never blocks, so a slow
+// client can not hold up the delivery to the other connections.
+func (s *SSEHub) send(sseConn *messagerooms.EventsourceConnection, evt messagerooms.EventMessage) {
+	evt.QueuedAt = time.Now()
+	err := sseConn.PublishEvent(evt)
+	s.config.QueueDepth.Observe(float64(sseConn.QueueDepth()))
+
+	topic := topicLabel(evt)
+	switch err {
+	case nil:
+	case messagerooms.ErrEventCoalesced:
+		s.config.DroppedEvents.With("reason", dropReasonCoalesced, "topic", topic).Add(1)
+	case messagerooms.ErrConnectionOverflow:
+		s.config.DroppedEvents.With("reason", dropReasonDisconnect, "topic", topic).Add(1)
+	default:
+		s.config.DroppedEvents.With("reason", dropReasonDropped, "topic", topic).Add(1)
+	}
+}
+
+// NewSSEHub returns a new hub instance. Metrics missing from the config are discarded.
+func NewSSEHub(subscriber pubsub.Subscriber, pubsub pubsub.Service, registry pubsub.ConnectionRegistry, config HubConfig) *SSEHub {
+	if config.DroppedEvents == nil {
+		config.DroppedEvents = discard.NewCounter()
 	}
 
-	// subscribe to the hub channel.
-	err := sseHub.pubsubConn.Subscribe(messagerooms.HubChannel)
-	if err != nil {
-		log.Printf("Could not connect to the hub: %s", err.Error())
-		panic(err)
+	if config.DeliveredEvents == nil {
+		config.DeliveredEvents = discard.NewCounter()
+	}
+
+	if config.QueueDepth == nil {
+		config.QueueDepth = discard.NewHistogram()
+	}
+
+	if config.OpenConnections == nil {
+		config.OpenConnections = discard.NewGauge()
+	}
+
+	if config.PublishLatency == nil {
+		config.PublishLatency = discard.NewHistogram()
+	}
+
+	if config.FlushLatency == nil {
+		config.FlushLatency = discard.NewHistogram()
+	}
+
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	if config.Tracer == nil {
+		config.Tracer = noop.NewTracerProvider().Tracer("")
+	}
+
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = defaultReconnectDelay
+	}
+
+	sseHub := &SSEHub{
+		NewConnection:   make(chan *messagerooms.EventsourceConnection),
+		CloseConnection: make(chan *messagerooms.EventsourceConnection),
+		OpenConnections: make(map[string]*messagerooms.EventsourceConnection),
+		pollSessions:    make(map[string]*pollSession),
+		config:          config,
+		drained:         make(chan struct{}),
+		quit:            make(chan struct{}),
+		receiving:       make(chan struct{}),
+		probe:           make(chan struct{}),
+		subscriber:      subscriber,
+		pubsub:          pubsub,
+		registry:        registry,
 	}
 
 	sseHub.Listen()
 	sseHub.ReceiveHubEvents()
+	go sseHub.expirePollSessions()
 
 	return sseHub
 }
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+func TestUserConnectionLimit(t *testing.T) {
+	hub := newTestHub(t, HubConfig{MaxConnectionsPerUser: 2})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+	bob := &messagerooms.User{ID: "bob", Nickname: "bob"}
+
+	// alice has a connection open on another node, and one on this node.
+	_ = hub.registry.Register(t.Context(), messagerooms.ConnectionInfo{ConnectionID: "elsewhere", UserID: alice.ID, NodeID: "node-2"})
+	hub.open(t, alice)
+
+	w := httptest.NewRecorder()
+	hub.HandleSSE(w, request(t, http.MethodGet, "/connect", alice, nil))
+	decodeResponse(t, w, http.StatusTooManyRequests, nil)
+
+	w = httptest.NewRecorder()
+	hub.HandlePoll(w, request(t, http.MethodGet, "/poll", alice, nil))
+	decodeResponse(t, w, http.StatusTooManyRequests, nil)
+
+	// the limit is checked by the handlers, the hub goroutine never waits for the registry.
+	lookups := hub.registry.lookupCount()
+	conn := hub.open(t, bob)
+	if evt := expectEvent(t, conn); evt.Event != messagerooms.ConnectionEvent {
+		t.Errorf("event of bob's connection = %q, want %q", evt.Event, messagerooms.ConnectionEvent)
+	}
+
+	if n := hub.registry.lookupCount() - lookups; n != 0 {
+		t.Errorf("hub listed the user connections %d times", n)
+	}
+}
+
+func TestSlowRegistryDoesNotBlockHub(t *testing.T) {
+	hub := newTestHub(t, HubConfig{})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+	bob := &messagerooms.User{ID: "bob", Nickname: "bob"}
+
+	release := hub.registry.holdRegistrations()
+	var connections []*messagerooms.EventsourceConnection
+	for _, user := range []*messagerooms.User{alice, bob} {
+		conn := messagerooms.NewEventsourceConnection(user, 10, messagerooms.OverflowDropOldest)
+		select {
+		case hub.NewConnection <- conn:
+		case <-time.After(time.Second):
+			t.Fatalf("hub did not take the connection of %s while the registry is slow", user.ID)
+		}
+		connections = append(connections, conn)
+	}
+
+	// the hub still answers the health check while the connections wait for the registry.
+	hub.sync(t)
+	for _, conn := range connections {
+		if evts := conn.Drain(); len(evts) != 0 {
+			t.Errorf("events before the connection is registered = %+v, want none", evts)
+		}
+	}
+
+	close(release)
+	for _, conn := range connections {
+		if evt := expectEvent(t, conn); evt.Event != messagerooms.ConnectionEvent {
+			t.Errorf("event of the connection = %q, want %q", evt.Event, messagerooms.ConnectionEvent)
+		}
+
+		hub.CloseConnection <- conn
+	}
+}
+
+func TestNodeConnectionLimit(t *testing.T) {
+	hub := newTestHub(t, HubConfig{MaxConnectionsPerNode: 1})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+	bob := &messagerooms.User{ID: "bob", Nickname: "bob"}
+
+	hub.open(t, alice)
+
+	w := httptest.NewRecorder()
+	hub.HandleSSE(w, request(t, http.MethodGet, "/connect", bob, nil))
+	decodeResponse(t, w, http.StatusServiceUnavailable, nil)
+
+	w = httptest.NewRecorder()
+	hub.HandlePoll(w, request(t, http.MethodGet, "/poll", bob, nil))
+	decodeResponse(t, w, http.StatusServiceUnavailable, nil)
+
+	hub.sync(t)
+	hub.mu.Lock()
+	open := len(hub.OpenConnections)
+	hub.mu.Unlock()
+
+	if open != 1 {
+		t.Errorf("open connections = %d, want 1", open)
+	}
+}
+
+func TestSendBufferOverflowDisconnects(t *testing.T) {
+	hub := newTestHub(t, HubConfig{SendBufferSize: 1, OverflowPolicy: messagerooms.OverflowDisconnect})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+	// the connection event fills the buffer of the connection.
+	conn := hub.open(t, alice)
+	room := messagerooms.Room{ID: "room-1", RoomName: "room-1", UserID: alice.ID}
+	if err := hub.pubsub.Publish(t.Context(), &messagerooms.RoomCreatedEvent{Room: room}); err != nil {
+		t.Fatalf("publishing room: %v", err)
+	}
+
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Fatal("overflowed connection is not disconnected")
+	}
+
+	if conn.Err() != messagerooms.ErrConnectionOverflow {
+		t.Errorf("disconnect reason = %v, want %v", conn.Err(), messagerooms.ErrConnectionOverflow)
+	}
+}
+
+func TestCloseHub(t *testing.T) {
+	hub := newTestHub(t, HubConfig{ReconnectDelay: time.Second})
+	alice := &messagerooms.User{ID: "alice", Nickname: "alice"}
+
+	conn := hub.open(t, alice)
+	expectEvent(t, conn)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	if err := hub.Close(ctx); err != nil {
+		t.Fatalf("closing hub: %v", err)
+	}
+
+	evt := expectEvent(t, conn)
+	if evt.Event != messagerooms.ReconnectEvent || evt.Retry < time.Second.Milliseconds() {
+		t.Errorf("event before closing = %q retry %dms, want %q retry at least 1000ms", evt.Event, evt.Retry, messagerooms.ReconnectEvent)
+	}
+
+	if conn.Err() != messagerooms.ErrServerShutdown {
+		t.Errorf("disconnect reason = %v, want %v", conn.Err(), messagerooms.ErrServerShutdown)
+	}
+
+	if hub.registry.connectionCount() != 0 {
+		t.Error("connection is still registered after closing the hub")
+	}
+
+	for _, topic := range alice.GetPersonalTopics() {
+		if hub.pubsub.subscribed(conn.ConnectionID, topic) {
+			t.Errorf("connection is still subscribed to %q", topic)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	hub.HandleSSE(w, request(t, http.MethodGet, "/connect", alice, nil))
+	decodeResponse(t, w, http.StatusServiceUnavailable, nil)
+}
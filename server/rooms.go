@@ -2,7 +2,9 @@ package server
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 
 	"github.com/iamsayantan/messagerooms"
 
@@ -22,6 +24,12 @@ var (
 
 	// ErrRoomNameEmpty is returned when user tries to create a room with empty room name
 	ErrRoomNameEmpty = errors.New("room name can not be empty")
+
+	// ErrInvalidPageLimit is returned when the number of listed items is not a positive number.
+	ErrInvalidPageLimit = errors.New("limit must be a positive number")
+
+	// ErrInvalidJoinedFilter is returned when the joined filter of the room listing is not a boolean.
+	ErrInvalidJoinedFilter = errors.New("joined must be either true or false")
 )
 
 // newMessageRequest request payload for posting new messages.
@@ -36,6 +44,7 @@ type createRoomRequest struct {
 
 type roomHandler struct {
 	service room.Service
+	logger  *slog.Logger
 }
 
 func (h *roomHandler) Route() chi.Router {
@@ -44,6 +53,7 @@ func (h *roomHandler) Route() chi.Router {
 	router.Post("/create", h.createRoom)
 	router.Get("/{roomID}", h.getRoomDetails)
 	router.Put("/{roomID}/join", h.joinRoom)
+	router.Get("/{roomID}/members", h.getMembers)
 	router.Get("/{roomID}/messages", h.getAllMessages)
 	router.Post("/{roomID}/messages", h.postMessage)
 	return router
@@ -73,9 +83,9 @@ func (h *roomHandler) createRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	createdRoom, err := h.service.CreateNewRoom(req.RoomName, *authenticatedUser)
+	createdRoom, err := h.service.CreateNewRoom(r.Context(), req.RoomName, *authenticatedUser)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -86,16 +96,59 @@ func (h *roomHandler) createRoom(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// allRooms lists the rooms a page at a time. The rooms are searched by name with q, restricted to the ones the user
+// joined with joined=true and sorted by name, activity or members. The next page is requested with the returned cursor.
 func (h *roomHandler) allRooms(w http.ResponseWriter, r *http.Request) {
-	rooms, err := h.service.AllRooms()
+	query := r.URL.Query()
+	options := room.ListOptions{
+		Search: query.Get("q"),
+		Sort:   messagerooms.RoomSort(query.Get("sort")),
+		Cursor: query.Get("cursor"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if options.Limit, err = strconv.Atoi(value); err != nil || options.Limit <= 0 {
+			_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidPageLimit))
+			return
+		}
+	}
+
+	if value := query.Get("joined"); value != "" {
+		joined, err := strconv.ParseBool(value)
+		if err != nil {
+			_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidJoinedFilter))
+			return
+		}
+
+		if joined {
+			authUser, ok := r.Context().Value(KeyAuthUser).(*messagerooms.User)
+			if !ok {
+				_ = render.Render(w, r, ErrInvalidRequest(errors.New("could not get user")))
+				return
+			}
+
+			options.JoinedBy = authUser
+		}
+	}
+
+	rooms, cursor, err := h.service.ListRooms(r.Context(), options)
 	if err != nil {
-		_ = render.Render(w, r, ErrInternalServer(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
+	if rooms == nil {
+		rooms = []*messagerooms.Room{}
+	}
+
 	resp := struct {
-		Rooms []*messagerooms.Room `json:"rooms"`
-	}{Rooms: rooms}
+		Rooms      []*messagerooms.Room `json:"rooms"`
+		NextCursor string               `json:"next_cursor,omitempty"`
+	}{
+		Rooms:      rooms,
+		NextCursor: cursor,
+	}
 
 	sendResponse(w, http.StatusOK, resp)
 }
@@ -114,13 +167,17 @@ func (h *roomHandler) getRoomDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomDetails, err := h.service.RoomDetails(roomID)
+	roomDetails, err := h.service.RoomDetails(r.Context(), roomID)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
-	exists := h.service.CheckUserExistsInRoom(*roomDetails, *authUser)
+	exists, err := h.service.CheckUserExistsInRoom(r.Context(), *roomDetails, *authUser)
+	if err != nil {
+		_ = render.Render(w, r, ErrFromService(err))
+		return
+	}
 
 	resp := struct {
 		Room     messagerooms.Room `json:"room_details"`
@@ -139,9 +196,9 @@ func (h *roomHandler) joinRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomDetails, err := h.service.RoomDetails(roomID)
+	roomDetails, err := h.service.FindRoom(r.Context(), roomID)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -152,8 +209,8 @@ func (h *roomHandler) joinRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.AddUserToRoom(*roomDetails, *authUser); err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+	if err := h.service.AddUserToRoom(r.Context(), *roomDetails, *authUser); err != nil {
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -164,6 +221,49 @@ func (h *roomHandler) joinRoom(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, http.StatusOK, resp)
 }
 
+// getMembers lists the members of the room a page at a time, the next page is requested with the returned cursor.
+func (h *roomHandler) getMembers(w http.ResponseWriter, r *http.Request) {
+	roomID := chi.URLParam(r, "roomID")
+	if roomID == "" {
+		_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidRoomID))
+		return
+	}
+
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidPageLimit))
+			return
+		}
+	}
+
+	roomDetails, err := h.service.FindRoom(r.Context(), roomID)
+	if err != nil {
+		_ = render.Render(w, r, ErrFromService(err))
+		return
+	}
+
+	members, cursor, err := h.service.RoomMembers(r.Context(), *roomDetails, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		_ = render.Render(w, r, ErrFromService(err))
+		return
+	}
+
+	if members == nil {
+		members = []*messagerooms.User{}
+	}
+
+	resp := struct {
+		Members    []*messagerooms.User `json:"members"`
+		NextCursor string               `json:"next_cursor,omitempty"`
+	}{
+		Members:    members,
+		NextCursor: cursor,
+	}
+	sendResponse(w, http.StatusOK, resp)
+}
+
 func (h *roomHandler) postMessage(w http.ResponseWriter, r *http.Request) {
 	var messageReq newMessageRequest
 
@@ -189,9 +289,9 @@ func (h *roomHandler) postMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomDetails, err := h.service.RoomDetails(roomID)
+	roomDetails, err := h.service.FindRoom(r.Context(), roomID)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -202,16 +302,24 @@ func (h *roomHandler) postMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg, err := h.service.PostMessage(*roomDetails, *authUser, messageReq.MessageText)
-	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+	// the message is still posted if it could not be delivered in realtime, the client is informed about it so
+	// that it can refresh the room messages later.
+	msg, err := h.service.PostMessage(r.Context(), *roomDetails, *authUser, messageReq.MessageText)
+	if err != nil && !errors.Is(err, room.ErrRealtimeDeliveryFailed) {
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
+	if err != nil {
+		h.logger.WarnContext(r.Context(), "message not delivered in realtime", "message_id", msg.ID, "err", err)
+	}
+
 	resp := struct {
-		Message messagerooms.Message `json:"message"`
+		Message           messagerooms.Message `json:"message"`
+		RealtimeDelivered bool                 `json:"realtime_delivered"`
 	}{
-		Message: *msg,
+		Message:           *msg,
+		RealtimeDelivered: err == nil,
 	}
 
 	sendResponse(w, http.StatusOK, resp)
@@ -224,9 +332,9 @@ func (h *roomHandler) getAllMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	roomDetails, err := h.service.RoomDetails(roomID)
+	roomDetails, err := h.service.FindRoom(r.Context(), roomID)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -237,14 +345,20 @@ func (h *roomHandler) getAllMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if exists := h.service.CheckUserExistsInRoom(*roomDetails, *authUser); !exists {
+	exists, err := h.service.CheckUserExistsInRoom(r.Context(), *roomDetails, *authUser)
+	if err != nil {
+		_ = render.Render(w, r, ErrFromService(err))
+		return
+	}
+
+	if !exists {
 		_ = render.Render(w, r, ErrInvalidRequest(errors.New("you do not have permission to view messages in the room")))
 		return
 	}
 
-	messages, err := h.service.GetAllRoomMessages(*roomDetails)
+	messages, err := h.service.GetAllRoomMessages(r.Context(), *roomDetails)
 	if err != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(err))
+		_ = render.Render(w, r, ErrFromService(err))
 		return
 	}
 
@@ -256,7 +370,7 @@ func (h *roomHandler) getAllMessages(w http.ResponseWriter, r *http.Request) {
 }
 
 // newRoomHandler returns a new roomHandler instance.
-func newRoomHandler(rs room.Service) WebHandler {
-	rh := &roomHandler{service: rs}
+func newRoomHandler(rs room.Service, logger *slog.Logger) WebHandler {
+	rh := &roomHandler{service: rs, logger: logger}
 	return rh
 }
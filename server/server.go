@@ -5,22 +5,34 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/cors"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/go-chi/chi"
 	chiware "github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/iamsayantan/messagerooms"
 	"github.com/iamsayantan/messagerooms/room"
 	"github.com/iamsayantan/messagerooms/user"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // maximum bytes allowed in request body. 1MB
 var maxAllowedLimit int64 = 1048576
 
+// Metrics holds the metrics of the HTTP requests.
+type Metrics struct {
+	RequestCount   metrics.Counter   // RequestCount counts the requests, labelled by method, route and status
+	RequestLatency metrics.Histogram // RequestLatency observes the seconds spent on the requests, labelled by method, route and status
+}
+
 // Server holds the dependencies for handling all the interactions.
 type Server struct {
 	User user.Service
@@ -28,29 +40,55 @@ type Server struct {
 
 	Hub    *SSEHub
 	router chi.Router
+	logger *slog.Logger
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Received HTTP Request: %s", r.URL)
 	s.router.ServeHTTP(w, r)
 }
 
-// NewServer returns a new HTTP server.
-func NewServer(us user.Service, rs room.Service, hub *SSEHub) *Server {
+// NewServer returns a new HTTP server. Every request is logged to the logger and traced with the tracer, the default
+// logger is used if it is nil and nothing is traced if the tracer is nil. The requests, except the event streams,
+// are cancelled after the request timeout, DefaultRequestTimeout if it is not positive. The readiness probe runs the
+// checks along with the one of the hub. The metrics missing from httpMetrics are discarded.
+func NewServer(us user.Service, rs room.Service, hub *SSEHub, logger *slog.Logger, tracer trace.Tracer, httpMetrics Metrics, requestTimeout time.Duration, checks map[string]HealthCheck) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	if httpMetrics.RequestCount == nil {
+		httpMetrics.RequestCount = discard.NewCounter()
+	}
+
+	if httpMetrics.RequestLatency == nil {
+		httpMetrics.RequestLatency = discard.NewHistogram()
+	}
+
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer("")
+	}
+
 	s := &Server{
-		User: us,
-		Room: rs,
-		Hub:  hub,
+		User:   us,
+		Room:   rs,
+		Hub:    hub,
+		logger: logger,
 	}
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", RequestIDHeader, "traceparent", "tracestate"},
+		ExposedHeaders: []string{RequestIDHeader},
 	})
 	am := newAuthMiddleware(us)
+	tm := newTimeoutMiddleware(requestTimeout)
 
 	r := chi.NewRouter()
+	r.Use(newRequestIDMiddleware().Register)
+	r.Use(newTracingMiddleware(tracer).Register)
+	r.Use(newAccessLogMiddleware(logger).Register)
+	r.Use(newMetricsMiddleware(httpMetrics.RequestCount, httpMetrics.RequestLatency).Register)
 	r.Use(chiware.AllowContentType("application/json"))
 	r.Use(corsHandler.Handler)
 
@@ -68,22 +106,34 @@ func NewServer(us user.Service, rs room.Service, hub *SSEHub) *Server {
 		// Authentication middleware
 		r.Use(am.Register)
 		r.Get("/connect", http.HandlerFunc(s.Hub.HandleSSE))
+
+		h := newSSEHandler(s.Hub, rs, tm)
+		r.Mount("/v1", h.Route())
 	})
 
 	r.Route("/user", func(r chi.Router) {
+		r.Use(tm.Register)
 		h := NewUserHandler(us, am)
 		r.Mount("/v1", h.Route())
 	})
 
 	r.Route("/rooms", func(r chi.Router) {
+		r.Use(tm.Register)
 		r.Use(am.Register)
-		h := newRoomHandler(rs)
+		h := newRoomHandler(rs, logger)
 		r.Mount("/v1", h.Route())
 	})
 
 	r.Method("GET", "/metrics", promhttp.Handler())
 
-	s.router = r
+	// the probes are served outside of the middlewares, so they don't flood the access logs and the traces.
+	health := newHealthHandler(hub, checks)
+	root := chi.NewRouter()
+	root.Get("/healthz", health.liveness)
+	root.Get("/readyz", health.readiness)
+	root.Mount("/", r)
+
+	s.router = root
 
 	return s
 }
@@ -178,6 +228,16 @@ func ErrNotFound(err error) render.Renderer {
 	}
 }
 
+// ErrConflict returns error response with appropiate status.
+func ErrConflict(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusConflict,
+		StatusText:     "Conflict",
+		ErrorText:      err.Error(),
+	}
+}
+
 // ErrUnAuthorized returns error response with appropiate status.
 func ErrUnAuthorized(err error) render.Renderer {
 	return &ErrResponse{
@@ -188,6 +248,36 @@ func ErrUnAuthorized(err error) render.Renderer {
 	}
 }
 
+// ErrForbidden returns error response with appropiate status.
+func ErrForbidden(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "Forbidden",
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrTooManyRequests returns error response with appropiate status.
+func ErrTooManyRequests(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusTooManyRequests,
+		StatusText:     "Too Many Requests",
+		ErrorText:      err.Error(),
+	}
+}
+
+// ErrServiceUnavailable returns error response with appropiate status.
+func ErrServiceUnavailable(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusServiceUnavailable,
+		StatusText:     "Service Unavailable",
+		ErrorText:      err.Error(),
+	}
+}
+
 // ErrInternalServer returns error response with appropiate status.
 func ErrInternalServer(err error) render.Renderer {
 	return &ErrResponse{
@@ -197,3 +287,18 @@ func ErrInternalServer(err error) render.Renderer {
 		ErrorText:      err.Error(),
 	}
 }
+
+// ErrFromService returns the error response for an error of the services by its kind, the errors of no kind are about
+// the request. The failure behind an unavailable storage is not disclosed to the client.
+func ErrFromService(err error) render.Renderer {
+	switch {
+	case errors.Is(err, messagerooms.ErrNotFound):
+		return ErrNotFound(err)
+	case errors.Is(err, messagerooms.ErrConflict):
+		return ErrConflict(err)
+	case errors.Is(err, messagerooms.ErrUnavailable):
+		return ErrServiceUnavailable(messagerooms.ErrUnavailable)
+	default:
+		return ErrInvalidRequest(err)
+	}
+}
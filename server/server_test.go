@@ -0,0 +1,321 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/pubsub"
+)
+
+// fakePubSub is the pubsub system of a single node, held in process. It is both the pubsub.Service and the
+// pubsub.Subscriber of the hub, the published events are handed to the hub for every subscribed connection.
+type fakePubSub struct {
+	mu            sync.Mutex
+	subscriptions map[string]map[string]bool // subscriptions holds the subscribed connection ids keyed by topic
+	handler       func(evt *messagerooms.PublishEvent)
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{subscriptions: make(map[string]map[string]bool), closed: make(chan struct{})}
+}
+
+func (p *fakePubSub) Publish(ctx context.Context, data messagerooms.Publishable) error {
+	p.mu.Lock()
+	handler := p.handler
+	var connectionIDs []string
+	for connectionID := range p.subscriptions[data.GetTopic()] {
+		connectionIDs = append(connectionIDs, connectionID)
+	}
+	p.mu.Unlock()
+
+	if handler == nil {
+		return nil
+	}
+
+	for _, connectionID := range connectionIDs {
+		handler(data.ToPublish(connectionID))
+	}
+
+	return nil
+}
+
+func (p *fakePubSub) Subscribe(ctx context.Context, connectionID string, topics ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, topic := range topics {
+		if p.subscriptions[topic] == nil {
+			p.subscriptions[topic] = make(map[string]bool)
+		}
+		p.subscriptions[topic][connectionID] = true
+	}
+
+	return nil
+}
+
+func (p *fakePubSub) Unsubscribe(ctx context.Context, connectionID string, topics ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, topic := range topics {
+		delete(p.subscriptions[topic], connectionID)
+	}
+
+	return nil
+}
+
+// subscribed reports whether the connection is subscribed to the topic.
+func (p *fakePubSub) subscribed(connectionID, topic string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.subscriptions[topic][connectionID]
+}
+
+func (p *fakePubSub) ReceiveEvents(handler func(evt *messagerooms.PublishEvent)) error {
+	p.mu.Lock()
+	p.handler = handler
+	p.mu.Unlock()
+
+	<-p.closed
+	return pubsub.ErrSubscriberClosed
+}
+
+// receiving reports whether the hub started receiving the published events.
+func (p *fakePubSub) receiving() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.handler != nil
+}
+
+func (p *fakePubSub) HealthCheck(ctx context.Context) error { return nil }
+
+func (p *fakePubSub) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+// fakeRegistry is the connection registry of a single node, held in process. The connections of other nodes are
+// added to it directly.
+type fakeRegistry struct {
+	mu          sync.Mutex
+	connections map[string]messagerooms.ConnectionInfo
+	lookups     int           // lookups is the number of times the connections of a user were listed
+	release     chan struct{} // release holds the registrations back until it is closed, if set
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{connections: make(map[string]messagerooms.ConnectionInfo)}
+}
+
+func (r *fakeRegistry) Register(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	r.mu.Lock()
+	release := r.release
+	r.mu.Unlock()
+
+	if release != nil {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.connections[info.ConnectionID] = info
+	return nil
+}
+
+func (r *fakeRegistry) Deregister(ctx context.Context, info messagerooms.ConnectionInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.connections, info.ConnectionID)
+	return nil
+}
+
+func (r *fakeRegistry) UserConnections(ctx context.Context, userID string) ([]messagerooms.ConnectionInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups++
+	var connections []messagerooms.ConnectionInfo
+	for _, info := range r.connections {
+		if info.UserID == userID {
+			connections = append(connections, info)
+		}
+	}
+
+	return connections, nil
+}
+
+func (r *fakeRegistry) Close() error { return nil }
+
+// holdRegistrations makes the registrations wait until the returned channel is closed, like a slow registry.
+func (r *fakeRegistry) holdRegistrations() chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.release = make(chan struct{})
+	return r.release
+}
+
+func (r *fakeRegistry) connectionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.connections)
+}
+
+func (r *fakeRegistry) lookupCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lookups
+}
+
+// testHub is a hub wired to the in-process pubsub system and registry.
+type testHub struct {
+	*SSEHub
+	pubsub   *fakePubSub
+	registry *fakeRegistry
+}
+
+// newTestHub returns a running hub with the config, it is closed when the test ends.
+func newTestHub(t *testing.T, config HubConfig) *testHub {
+	t.Helper()
+
+	if config.SendBufferSize == 0 {
+		config.SendBufferSize = 10
+	}
+
+	if config.OverflowPolicy == "" {
+		config.OverflowPolicy = messagerooms.OverflowDropOldest
+	}
+
+	ps, registry := newFakePubSub(), newFakeRegistry()
+	hub := &testHub{SSEHub: NewSSEHub(ps, ps, registry, config), pubsub: ps, registry: registry}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_ = hub.Close(ctx)
+	})
+
+	// the events published before the hub receives them would be lost.
+	deadline := time.Now().Add(time.Second)
+	for !ps.receiving() {
+		if time.Now().After(deadline) {
+			t.Fatal("hub is not receiving events")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return hub
+}
+
+// open opens a connection of the user like the handlers do, and waits for the hub to register and subscribe it. Like
+// the handlers, the connection is closed once the server disconnects it.
+func (h *testHub) open(t *testing.T, user *messagerooms.User) *messagerooms.EventsourceConnection {
+	t.Helper()
+
+	conn := messagerooms.NewEventsourceConnection(user, h.config.SendBufferSize, h.config.OverflowPolicy)
+	h.NewConnection <- conn
+	h.sync(t)
+
+	// the connection is subscribed to its control topic last.
+	deadline := time.Now().Add(time.Second)
+	for !h.pubsub.subscribed(conn.ConnectionID, conn.ControlTopic()) {
+		if time.Now().After(deadline) {
+			t.Fatal("connection is not subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		<-conn.Done()
+		select {
+		case h.CloseConnection <- conn:
+		case <-h.quit:
+		}
+	}()
+
+	return conn
+}
+
+// sync waits for the hub goroutine to be done with the connections sent to it before.
+func (h *testHub) sync(t *testing.T) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	if err := h.HealthCheck(ctx); err != nil {
+		t.Fatalf("hub is not responding: %v", err)
+	}
+}
+
+// expectEvent waits for the next event queued for the connection, skipping the heartbeats.
+func expectEvent(t *testing.T, conn *messagerooms.EventsourceConnection) messagerooms.EventMessage {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		for _, evt := range conn.Drain() {
+			if evt.Event != messagerooms.HeartbeatEvent {
+				return evt
+			}
+		}
+
+		select {
+		case <-conn.Ready():
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+// request returns a request of the user with the JSON body, if any.
+func request(t *testing.T, method, target string, user *messagerooms.User, body interface{}) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Set("Content-Type", "application/json")
+	return r.WithContext(context.WithValue(r.Context(), KeyAuthUser, user))
+}
+
+// decodeResponse decodes the JSON body of the response into v, after checking its status.
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+
+	if w.Code != status {
+		t.Fatalf("response status = %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+
+	if v == nil {
+		return
+	}
+
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/room"
+)
+
+var (
+	// ErrNoRoomsToSubscribe is returned when a subscription request does not contain any room.
+	ErrNoRoomsToSubscribe = errors.New("at least one room id must be provided")
+
+	// ErrNotRoomMember is returned when user tries to subscribe to the events of a room they are not a member of.
+	ErrNotRoomMember = errors.New("user is not a member of the room")
+)
+
+// subscriptionRequest request payload for (un)subscribing a connection to the activity of rooms.
+type subscriptionRequest struct {
+	Rooms []string `json:"rooms"`
+}
+
+type sseHandler struct {
+	hub     *SSEHub
+	room    room.Service
+	timeout Middleware
+}
+
+func (h *sseHandler) Route() chi.Router {
+	router := chi.NewRouter()
+	router.Get("/poll", h.hub.HandlePoll)
+
+	// polling waits for the events, only the other requests are bounded by the request timeout.
+	router.Group(func(r chi.Router) {
+		r.Use(h.timeout.Register)
+		r.Get("/connections", h.connections)
+		r.Delete("/connections/{connectionID}", h.terminate)
+		r.Post("/{connectionID}/subscriptions", h.subscribe)
+		r.Delete("/{connectionID}/subscriptions", h.unsubscribe)
+	})
+	return router
+}
+
+// connections lists the user's connections open on any node.
+func (h *sseHandler) connections(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := r.Context().Value(KeyAuthUser).(*messagerooms.User)
+	if !ok {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("could not get user")))
+		return
+	}
+
+	connections, err := h.hub.UserConnections(r.Context(), *authUser)
+	if err != nil {
+		_ = render.Render(w, r, ErrServiceUnavailable(err))
+		return
+	}
+
+	if connections == nil {
+		connections = []messagerooms.ConnectionInfo{}
+	}
+
+	resp := struct {
+		Connections []messagerooms.ConnectionInfo `json:"connections"`
+	}{Connections: connections}
+	sendResponse(w, http.StatusOK, resp)
+}
+
+// terminate disconnects one of the user's connections, on whichever node it is open.
+func (h *sseHandler) terminate(w http.ResponseWriter, r *http.Request) {
+	authUser, ok := r.Context().Value(KeyAuthUser).(*messagerooms.User)
+	if !ok {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("could not get user")))
+		return
+	}
+
+	if err := h.hub.TerminateConnection(r.Context(), chi.URLParam(r, "connectionID"), *authUser); err != nil {
+		renderConnectionError(w, r, err)
+		return
+	}
+
+	resp := struct {
+		OK bool `json:"ok"`
+	}{OK: true}
+	sendResponse(w, http.StatusOK, resp)
+}
+
+// subscribe subscribes the connection to the activity of the rooms the client is viewing. The user must be a member
+// of every room, otherwise none of them is subscribed.
+func (h *sseHandler) subscribe(w http.ResponseWriter, r *http.Request) {
+	authUser, roomIDs, ok := decodeSubscriptionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	topics := make([]string, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		roomDetails, err := h.room.FindRoom(r.Context(), roomID)
+		if err != nil {
+			_ = render.Render(w, r, ErrFromService(err))
+			return
+		}
+
+		exists, err := h.room.CheckUserExistsInRoom(r.Context(), *roomDetails, *authUser)
+		if err != nil {
+			_ = render.Render(w, r, ErrFromService(err))
+			return
+		}
+
+		if !exists {
+			_ = render.Render(w, r, ErrForbidden(ErrNotRoomMember))
+			return
+		}
+
+		topics = append(topics, roomDetails.GetActivityTopic())
+	}
+
+	err := h.hub.SubscribeConnection(r.Context(), chi.URLParam(r, "connectionID"), *authUser, topics...)
+	if err != nil {
+		renderConnectionError(w, r, err)
+		return
+	}
+
+	resp := struct {
+		Topics []string `json:"topics"`
+	}{Topics: topics}
+	sendResponse(w, http.StatusOK, resp)
+}
+
+// unsubscribe unsubscribes the connection from the activity of the rooms the client is not viewing anymore. The
+// rooms are neither looked up nor checked for membership, so a user who left a room, or whose room is gone, can still
+// unsubscribe from it.
+func (h *sseHandler) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	authUser, roomIDs, ok := decodeSubscriptionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	topics := make([]string, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		viewed := messagerooms.Room{ID: roomID}
+		topics = append(topics, viewed.GetActivityTopic())
+	}
+
+	err := h.hub.UnsubscribeConnection(r.Context(), chi.URLParam(r, "connectionID"), *authUser, topics...)
+	if err != nil {
+		renderConnectionError(w, r, err)
+		return
+	}
+
+	resp := struct {
+		OK bool `json:"ok"`
+	}{OK: true}
+	sendResponse(w, http.StatusOK, resp)
+}
+
+// decodeSubscriptionRequest returns the authenticated user and the ids of the rooms in the subscription request. The
+// error response is already rendered when it's not ok.
+func decodeSubscriptionRequest(w http.ResponseWriter, r *http.Request) (*messagerooms.User, []string, bool) {
+	authUser, ok := r.Context().Value(KeyAuthUser).(*messagerooms.User)
+	if !ok {
+		_ = render.Render(w, r, ErrInvalidRequest(errors.New("could not get user")))
+		return nil, nil, false
+	}
+
+	var req subscriptionRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		var mr *malformedRequest
+		if errors.As(err, &mr) {
+			_ = render.Render(w, r, ErrInvalidRequest(mr))
+		} else {
+			_ = render.Render(w, r, ErrInternalServer(err))
+		}
+		return nil, nil, false
+	}
+
+	if len(req.Rooms) == 0 {
+		_ = render.Render(w, r, ErrInvalidRequest(ErrNoRoomsToSubscribe))
+		return nil, nil, false
+	}
+
+	for _, roomID := range req.Rooms {
+		if roomID == "" {
+			_ = render.Render(w, r, ErrInvalidRequest(ErrInvalidRoomID))
+			return nil, nil, false
+		}
+	}
+
+	return authUser, req.Rooms, true
+}
+
+// renderConnectionError renders the errors of the hub operations on a connection.
+func renderConnectionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case ErrConnectionNotFound:
+		_ = render.Render(w, r, ErrNotFound(err))
+	case ErrTooManySubscriptions:
+		_ = render.Render(w, r, ErrInvalidRequest(err))
+	default:
+		_ = render.Render(w, r, ErrServiceUnavailable(err))
+	}
+}
+
+func newSSEHandler(hub *SSEHub, rs room.Service, tm Middleware) WebHandler {
+	h := &sseHandler{hub: hub, room: rs, timeout: tm}
+	return h
+}
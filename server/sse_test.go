@@ -0,0 +1,133 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/inmem"
+	"github.com/iamsayantan/messagerooms/room"
+)
+
+// sseFixture serves the sse routes with a room service and users in memory.
+type sseFixture struct {
+	hub     *testHub
+	rooms   room.Service
+	users   messagerooms.UserRepository
+	handler http.Handler
+}
+
+func newSSEFixture(t *testing.T) *sseFixture {
+	db := inmem.NewDB()
+	hub := newTestHub(t, HubConfig{})
+	rs := room.NewService(inmem.NewRoomRepository(db), inmem.NewMessageRepository(db), inmem.NewUnitOfWork(db), hub.pubsub, nil)
+
+	return &sseFixture{
+		hub:     hub,
+		rooms:   rs,
+		users:   inmem.NewUserRepository(db),
+		handler: newSSEHandler(hub.SSEHub, rs, newTimeoutMiddleware(time.Second)).Route(),
+	}
+}
+
+func (f *sseFixture) createUser(t *testing.T, nickname string) *messagerooms.User {
+	t.Helper()
+
+	user, err := f.users.Create(t.Context(), nickname, "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	return user
+}
+
+func (f *sseFixture) createRoom(t *testing.T, name string, owner *messagerooms.User) *messagerooms.Room {
+	t.Helper()
+
+	created, err := f.rooms.CreateNewRoom(t.Context(), name, *owner)
+	if err != nil {
+		t.Fatalf("creating room: %v", err)
+	}
+
+	return created
+}
+
+func (f *sseFixture) serve(r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	f.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestSubscribeRequiresMembership(t *testing.T) {
+	f := newSSEFixture(t)
+	alice, bob := f.createUser(t, "alice"), f.createUser(t, "bob")
+	general := f.createRoom(t, "general", alice)
+	conn := f.hub.open(t, bob)
+
+	body := subscriptionRequest{Rooms: []string{general.ID}}
+	w := f.serve(request(t, http.MethodPost, "/"+conn.ConnectionID+"/subscriptions", bob, body))
+	decodeResponse(t, w, http.StatusForbidden, nil)
+
+	if topics := conn.Subscriptions(); len(topics) != 0 {
+		t.Errorf("connection of a non member subscribed to %v", topics)
+	}
+
+	if f.hub.pubsub.subscribed(conn.ConnectionID, general.GetActivityTopic()) {
+		t.Error("connection of a non member is subscribed to the room activity")
+	}
+}
+
+func TestSubscribeWithoutRooms(t *testing.T) {
+	f := newSSEFixture(t)
+	alice := f.createUser(t, "alice")
+	conn := f.hub.open(t, alice)
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		w := f.serve(request(t, method, "/"+conn.ConnectionID+"/subscriptions", alice, subscriptionRequest{Rooms: []string{}}))
+		decodeResponse(t, w, http.StatusBadRequest, nil)
+	}
+}
+
+func TestSubscribeAndUnsubscribe(t *testing.T) {
+	f := newSSEFixture(t)
+	alice := f.createUser(t, "alice")
+	general := f.createRoom(t, "general", alice)
+	conn := f.hub.open(t, alice)
+	expectEvent(t, conn) // the connection event
+
+	body := subscriptionRequest{Rooms: []string{general.ID}}
+	var subscribed struct {
+		Topics []string `json:"topics"`
+	}
+	w := f.serve(request(t, http.MethodPost, "/"+conn.ConnectionID+"/subscriptions", alice, body))
+	decodeResponse(t, w, http.StatusOK, &subscribed)
+
+	if !slices.Equal(subscribed.Topics, []string{general.GetActivityTopic()}) {
+		t.Errorf("subscribed topics = %v, want the activity of %s", subscribed.Topics, general.ID)
+	}
+
+	if !f.hub.pubsub.subscribed(conn.ConnectionID, general.GetActivityTopic()) {
+		t.Fatal("connection is not subscribed to the room activity")
+	}
+
+	// a room which is gone is unsubscribed from without being looked up.
+	body.Rooms = append(body.Rooms, "deleted-room")
+	w = f.serve(request(t, http.MethodDelete, "/"+conn.ConnectionID+"/subscriptions", alice, body))
+	decodeResponse(t, w, http.StatusOK, nil)
+
+	if f.hub.pubsub.subscribed(conn.ConnectionID, general.GetActivityTopic()) {
+		t.Error("connection is still subscribed to the room activity")
+	}
+
+	if topics := conn.Subscriptions(); len(topics) != 0 {
+		t.Errorf("connection subscriptions after unsubscribing = %v, want none", topics)
+	}
+
+	// the connections of other users are not found.
+	bob := f.createUser(t, "bob")
+	w = f.serve(request(t, http.MethodDelete, "/"+conn.ConnectionID+"/subscriptions", bob, body))
+	decodeResponse(t, w, http.StatusNotFound, nil)
+}
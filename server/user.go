@@ -49,7 +49,7 @@ func (h *userHandler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usr, er := h.service.Login(loginReq.Nickname, loginReq.Password)
+	usr, er := h.service.Login(r.Context(), loginReq.Nickname, loginReq.Password)
 	if er != nil {
 		// if error is invalid password, then just returning
 		if er == user.ErrInvalidPassword {
@@ -58,17 +58,23 @@ func (h *userHandler) login(w http.ResponseWriter, r *http.Request) {
 		} else if er == user.ErrInvalidNickname {
 			// so if user is trying to login with a nickname with does not exist then we will create a new
 			// record with the given details and log the user in.
-			usr, er = h.service.NewUser(loginReq.Nickname, loginReq.Password)
+			usr, er = h.service.NewUser(r.Context(), loginReq.Nickname, loginReq.Password)
 			if er != nil {
-				_ = render.Render(w, r, ErrInvalidRequest(er))
+				_ = render.Render(w, r, ErrFromService(er))
 				return
 			}
 		} else {
-			_ = render.Render(w, r, ErrInternalServer(er))
+			_ = render.Render(w, r, ErrFromService(er))
+			return
 		}
 	}
 
-	token, _ := h.service.GenerateAuthToken(*usr)
+	token, er := h.service.GenerateAuthToken(r.Context(), *usr)
+	if er != nil {
+		_ = render.Render(w, r, ErrInternalServer(er))
+		return
+	}
+
 	resp := struct {
 		User        *messagerooms.User `json:"user"`
 		AccessToken string             `json:"access_token"`
@@ -93,9 +99,9 @@ func (h *userHandler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	usr, er := h.service.NewUser(registerRequest.Nickname, registerRequest.Password)
+	usr, er := h.service.NewUser(r.Context(), registerRequest.Nickname, registerRequest.Password)
 	if er != nil {
-		_ = render.Render(w, r, ErrInvalidRequest(er))
+		_ = render.Render(w, r, ErrFromService(er))
 		return
 	}
 
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS users (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    password VARCHAR(255),
+    nickname VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    room_name VARCHAR(255),
+    user_id VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS room_users (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (room_id, user_id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id VARCHAR(255) NOT NULL PRIMARY KEY,
+    user_id VARCHAR(255),
+    room_id VARCHAR(255),
+    message_text VARCHAR(255),
+    created_at DATETIME NULL
+);
@@ -0,0 +1,2 @@
+-- Users are looked up by their nickname on login, it must identify a single user.
+CREATE UNIQUE INDEX IF NOT EXISTS uix_users_nickname ON users (nickname);
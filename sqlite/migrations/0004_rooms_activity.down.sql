@@ -0,0 +1,3 @@
+-- The owners who joined their rooms in the up migration stay members, they can not be told apart from the others.
+ALTER TABLE rooms DROP COLUMN last_activity_at;
+ALTER TABLE rooms DROP COLUMN message_count;
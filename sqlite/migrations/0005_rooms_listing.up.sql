@@ -0,0 +1,11 @@
+ALTER TABLE rooms ADD COLUMN last_message_id VARCHAR(255) NULL;
+
+-- The last message previews the room in the listings, the rooms of the existing messages are brought up to date.
+UPDATE rooms SET last_message_id = (
+    SELECT messages.id FROM messages WHERE messages.room_id = rooms.id
+    ORDER BY messages.created_at DESC, messages.id DESC LIMIT 1
+);
+
+-- The rooms are listed by their name or their last activity.
+CREATE INDEX IF NOT EXISTS idx_rooms_room_name ON rooms (room_name);
+CREATE INDEX IF NOT EXISTS idx_rooms_last_activity_at ON rooms (last_activity_at);
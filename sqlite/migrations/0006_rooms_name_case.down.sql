@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_rooms_lower_room_name;
+CREATE INDEX IF NOT EXISTS idx_rooms_room_name ON rooms (room_name);
@@ -0,0 +1,7 @@
+ALTER TABLE rooms ADD COLUMN member_count INTEGER NOT NULL DEFAULT 0;
+
+-- Joining a room counts the new member, the rooms of the existing members are brought up to date.
+UPDATE rooms SET member_count = (SELECT COUNT(*) FROM room_users WHERE room_users.room_id = rooms.id);
+
+-- The rooms are listed by their number of members, the rooms with as many members are ordered by their id.
+CREATE INDEX IF NOT EXISTS idx_rooms_member_count ON rooms (member_count DESC, id);
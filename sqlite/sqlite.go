@@ -0,0 +1,61 @@
+// Package sqlite runs the store on a local SQLite database file, so the server can run as a single binary. The
+// database is accessed with a pure Go driver, no C toolchain is needed.
+package sqlite
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/url"
+
+	gormsqlite "github.com/glebarez/sqlite"
+	"github.com/iamsayantan/messagerooms/gormstore"
+	"gorm.io/gorm"
+)
+
+// busyTimeout is how long, in milliseconds, a connection waits for the lock of another connection writing to the
+// database.
+const busyTimeout = "5000"
+
+// migrations holds the schema of the SQLite database as versioned migrations.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the database file at path, creating it if it does not exist. The database runs in WAL mode, so the
+// readers are not blocked by the writer.
+func Open(path string, config *gorm.Config) (*gormstore.Store, error) {
+	scripts, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout("+busyTimeout+")")
+	params.Add("_pragma", "foreign_keys(ON)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+
+	dialect := gormstore.Dialect{System: "sqlite", IsDuplicatedKey: isDuplicatedKey, Migrations: scripts}
+	store, err := gormstore.Open(gormsqlite.Open("file:"+path+"?"+params.Encode()), dialect, config)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := store.DB().DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer at a time, a single connection serializes the writes instead of having them
+	// fail with a busy database.
+	sqlDB.SetMaxOpenConns(1)
+
+	return store, nil
+}
+
+// isDuplicatedKey reports whether the query failed on a unique or primary key, whether or not the database was
+// opened with TranslateError.
+func isDuplicatedKey(err error) bool {
+	return errors.Is(gormsqlite.Dialector{}.Translate(err), gorm.ErrDuplicatedKey)
+}
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamsayantan/messagerooms/gormstore"
+	"github.com/iamsayantan/messagerooms/repositorytest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestStore opens a migrated database in a file removed when the test ends.
+func openTestStore(t *testing.T) *gormstore.Store {
+	t.Helper()
+
+	store, err := Open(filepath.Join(t.TempDir(), "messagerooms.db"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("opening sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	migrator, err := store.Migrator()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating database: %v", err)
+	}
+
+	return store
+}
+
+func TestRepositories(t *testing.T) {
+	store := openTestStore(t)
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return repositorytest.Repositories{
+			Users:      store.Users(),
+			Rooms:      store.Rooms(),
+			Messages:   store.Messages(),
+			UnitOfWork: store.UnitOfWork(),
+		}
+	})
+}
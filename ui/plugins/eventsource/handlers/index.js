@@ -1,9 +1,13 @@
 import connection from './connection'
 import heartbeat from './heartbeat'
 import MessageEvent from './messages'
+import RoomEvents from './rooms'
+import terminated from './terminated'
 
 export default [
   connection,
   heartbeat,
-  MessageEvent
+  MessageEvent,
+  ...RoomEvents,
+  terminated
 ]
\ No newline at end of file
@@ -1,16 +1,18 @@
 const message = {
-  eventType: 'MessageEvent',
+  eventType: 'new_message',
   handle: function (event, store) {
     const eventData = JSON.parse(event.data)
 
-    // match with the personal topics and take appropriate action.
-    // topics are appended with user's id with it
-    if (eventData.topic.startsWith('NewMessage')) {
-      const { message, room } = eventData.payload
+    // payloads of newer versions might not be understood, the messages are loaded again when the room is opened.
+    if (eventData.version !== 1) {
+      console.log('[NewMessage] Unsupported payload version', eventData.version)
+      return
+    }
+
+    const { message, room } = eventData.payload
 
-      if (store.getters.selected_room === room.id) {
-        store.commit('appendMessage', message)
-      }
+    if (store.getters.selected_room === room.id) {
+      store.commit('appendMessage', message)
     }
   }
 }
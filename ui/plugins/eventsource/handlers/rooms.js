@@ -0,0 +1,30 @@
+const roomCreated = {
+  eventType: 'room_created',
+  handle: function (event, store) {
+    const eventData = JSON.parse(event.data)
+
+    // payloads of newer versions might not be understood, the rooms are loaded again with the page.
+    if (eventData.version !== 1) {
+      console.log('[RoomCreated] Unsupported payload version', eventData.version)
+      return
+    }
+
+    store.commit('updateRoom', eventData.payload.room)
+  }
+}
+
+const membershipChanged = {
+  eventType: 'membership_changed',
+  handle: function (event, store) {
+    const eventData = JSON.parse(event.data)
+
+    if (eventData.version !== 1) {
+      console.log('[MembershipChanged] Unsupported payload version', eventData.version)
+      return
+    }
+
+    store.commit('updateRoom', eventData.payload.room)
+  }
+}
+
+export default [roomCreated, membershipChanged]
@@ -0,0 +1,12 @@
+const terminated = {
+  eventType: 'Terminated',
+  handle: function (event, store, eventSource) {
+    const parsed = JSON.parse(event.data)
+    console.log('[Eventsource] Connection terminated', parsed.reason)
+
+    // the connection was terminated on purpose, so it must not reconnect.
+    eventSource.close()
+  }
+}
+
+export default terminated
@@ -1,18 +1,30 @@
 import Handlers from './handlers'
+import LongPoll from './longpoll'
 
 import { EventSourcePolyfill } from 'event-source-polyfill'
 
+const registerHandlers = (transport, store) => {
+  for (const handler of Handlers) {
+    transport.addEventListener(handler.eventType, event => {
+      handler.handle(event, store, transport)
+    })
+  }
+}
+
 export default ({app, store}) => {
   if (!app.$auth.loggedIn) return
 
   const eventsourceRoute = '/api/sse/connect'
+  const pollRoute = '/api/sse/v1/poll'
   const eventSource = new EventSourcePolyfill(eventsourceRoute, {
     headers: {
       'Authorization': app.$auth.getToken('local')
     }
   });
 
+  let opened = false
   eventSource.addEventListener('open', (event) => {
+    opened = true
     console.log('[Eventsource] Connection Open', event)
   });
 
@@ -20,9 +32,18 @@ export default ({app, store}) => {
     console.log('[Eventsource] Connection Close', event)
   });
 
-  for (const handler of Handlers) {
-    eventSource.addEventListener(handler.eventType, event => {
-      handler.handle(event, store)
-    })
-  }
+  // the eventsource connection never opening usually means a proxy in between does not let the stream through,
+  // the events are polled instead.
+  eventSource.addEventListener('error', (event) => {
+    if (opened) return
+
+    console.log('[Eventsource] Could not connect, falling back to long polling', event)
+    eventSource.close()
+
+    const longPoll = new LongPoll(app.$axios, pollRoute)
+    registerHandlers(longPoll, store)
+    longPoll.start()
+  });
+
+  registerHandlers(eventSource, store)
 }
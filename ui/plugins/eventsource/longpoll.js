@@ -0,0 +1,52 @@
+// LongPoll receives the same events as the eventsource connection by polling the server, for the networks where
+// the eventsource connections don't work. Events are handed to the listeners in the same shape as eventsource events.
+export default class LongPoll {
+  constructor (axios, route) {
+    this.axios = axios
+    this.route = route
+    this.listeners = {}
+    this.connectionId = null
+    this.cursor = 0
+    this.closed = false
+  }
+
+  addEventListener (eventType, listener) {
+    this.listeners[eventType] = [...(this.listeners[eventType] || []), listener]
+  }
+
+  close () {
+    this.closed = true
+  }
+
+  async start () {
+    while (!this.closed) {
+      try {
+        const params = { cursor: this.cursor }
+        if (this.connectionId) params.connection_id = this.connectionId
+
+        const { data } = await this.axios.get(this.route, { params })
+        this.connectionId = data.connection_id
+        this.cursor = data.cursor
+
+        for (const evt of data.events) {
+          for (const listener of this.listeners[evt.event] || []) {
+            listener({ data: JSON.stringify(evt.data) })
+          }
+        }
+
+        // the server closed the connection, a new one is opened with the next poll.
+        if (data.closed) {
+          this.connectionId = null
+          this.cursor = 0
+        }
+      } catch (err) {
+        console.log('[LongPoll] Poll failed', err)
+        if (err.response && err.response.status === 404) {
+          this.connectionId = null
+          this.cursor = 0
+        }
+        await new Promise(resolve => setTimeout(resolve, 2000))
+      }
+    }
+  }
+}
@@ -6,6 +6,7 @@ export const state = () => ({
     connection_id: null
   },
   rooms: [],
+  rooms_cursor: null,
   selected_room: null,
   selected_room_details: {
     room: {},
@@ -27,8 +28,18 @@ export const mutations = {
     state.eventsource.connection_id = connID
   },
 
-  storeRooms(state, rooms) {
+  // storeRooms stores the first page of the listing, along with the cursor of the next page.
+  storeRooms(state, {rooms, cursor}) {
     state.rooms = rooms
+    state.rooms_cursor = cursor || null
+  },
+
+  // appendRooms adds the next page of the listing, leaving out the rooms already listed, like the ones created since
+  // the first page was loaded.
+  appendRooms(state, {rooms, cursor}) {
+    const listed = new Set(state.rooms.map(room => room.id))
+    state.rooms = [...state.rooms, ...rooms.filter(room => !listed.has(room.id))]
+    state.rooms_cursor = cursor || null
   },
 
   selectRoom(state, roomId) {
@@ -44,6 +55,21 @@ export const mutations = {
     state.rooms.push(room)
   },
 
+  // updateRoom replaces the room in the listing and in the details of the selected room, a room not listed yet is
+  // appended.
+  updateRoom(state, room) {
+    const index = state.rooms.findIndex(listed => listed.id === room.id)
+    if (index === -1) {
+      state.rooms.push(room)
+    } else {
+      state.rooms.splice(index, 1, room)
+    }
+
+    if (state.selected_room_details.room.id === room.id) {
+      state.selected_room_details.room = room
+    }
+  },
+
   storeMessages(state, messages) {
     state.room_messages = messages
   },
@@ -57,6 +83,9 @@ export const getters = {
   rooms(state) {
     return state.rooms
   },
+  rooms_cursor(state) {
+    return state.rooms_cursor
+  },
   selected_room(state) {
     return state.selected_room
   },
@@ -0,0 +1,17 @@
+package messagerooms
+
+import "context"
+
+// Repositories are the repositories of a single storage.
+type Repositories struct {
+	Users    UserRepository
+	Rooms    RoomRepository
+	Messages MessageRepository
+}
+
+// UnitOfWork runs changes spanning several repositories atomically.
+type UnitOfWork interface {
+	// Do calls fn with repositories bound to a transaction. The transaction is committed if fn returns nil, and
+	// rolled back otherwise, in which case the error of fn is returned as it is.
+	Do(ctx context.Context, fn func(repos Repositories) error) error
+}
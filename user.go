@@ -1,5 +1,7 @@
 package messagerooms
 
+import "context"
+
 // User type represents an user.
 type User struct {
 	ID       string `json:"id"`
@@ -18,9 +20,13 @@ func (u *User) GetPersonalTopics() []string {
 	}
 }
 
-// UserRepository provides methods for interacting with User storage.
+// UserRepository provides methods for interacting with User storage. The queries are cancelled along with the
+// context. The returned errors wrap ErrNotFound, ErrConflict or ErrUnavailable.
 type UserRepository interface {
-	Create(nickname, password string) (*User, error)
-	FindByID(id string) (*User, error)
-	FindByNickname(nickname string) (*User, error)
+	Create(ctx context.Context, nickname, password string) (*User, error)
+	FindByID(ctx context.Context, id string) (*User, error)
+	FindByNickname(ctx context.Context, nickname string) (*User, error)
+
+	// Update saves the nickname and the password of the user.
+	Update(ctx context.Context, user User) error
 }
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/iamsayantan/messagerooms"
+)
+
+type instrumentingService struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	loginCount     metrics.Counter
+	next           Service
+}
+
+func (s *instrumentingService) NewUser(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "new_user", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "new_user").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.NewUser(ctx, nickname, password)
+}
+
+func (s *instrumentingService) Login(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "login", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "login").Observe(time.Since(begin).Seconds())
+		s.loginCount.With("result", loginResult(err)).Add(1)
+	}(time.Now())
+
+	return s.next.Login(ctx, nickname, password)
+}
+
+func (s *instrumentingService) GenerateAuthToken(ctx context.Context, user messagerooms.User) (token string, err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "generate_auth_token", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "generate_auth_token").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.GenerateAuthToken(ctx, user)
+}
+
+func (s *instrumentingService) VerifyAuthToken(ctx context.Context, token string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		s.requestCount.With("method", "verify_auth_token", "error", fmt.Sprint(err != nil)).Add(1)
+		s.requestLatency.With("method", "verify_auth_token").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return s.next.VerifyAuthToken(ctx, token)
+}
+
+// loginResult labels the outcome of a login attempt.
+func loginResult(err error) string {
+	switch err {
+	case nil:
+		return "success"
+	case ErrInvalidNickname:
+		return "invalid_nickname"
+	case ErrInvalidPassword:
+		return "invalid_password"
+	default:
+		return "error"
+	}
+}
+
+// NewInstrumentingService returns an instance of an instrumenting Service. The counter is labelled by method and
+// whether the call failed, the histogram by method and the login counter by the result of the login attempts.
+func NewInstrumentingService(counter metrics.Counter, latency metrics.Histogram, logins metrics.Counter, s Service) Service {
+	return &instrumentingService{
+		requestCount:   counter,
+		requestLatency: latency,
+		loginCount:     logins,
+		next:           s,
+	}
+}
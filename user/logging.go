@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/iamsayantan/messagerooms"
+)
+
+type loggingService struct {
+	logger *slog.Logger
+	next   Service
+}
+
+func (s *loggingService) NewUser(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "new_user", "nickname", nickname, "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.NewUser(ctx, nickname, password)
+}
+
+func (s *loggingService) Login(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "login", "nickname", nickname, "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.Login(ctx, nickname, password)
+}
+
+func (s *loggingService) GenerateAuthToken(ctx context.Context, user messagerooms.User) (token string, err error) {
+	defer func(begin time.Time) {
+		s.log(ctx, err, "method", "generate_auth_token", "user_id", user.ID, "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.GenerateAuthToken(ctx, user)
+}
+
+func (s *loggingService) VerifyAuthToken(ctx context.Context, token string) (user *messagerooms.User, err error) {
+	defer func(begin time.Time) {
+		userID := ""
+		if user != nil {
+			userID = user.ID
+		}
+		s.log(ctx, err, "method", "verify_auth_token", "user_id", userID, "took", time.Since(begin))
+	}(time.Now())
+
+	return s.next.VerifyAuthToken(ctx, token)
+}
+
+// log logs the call at debug level, or at warn level if it failed. Failures are mostly bad credentials, so they are
+// not errors of the server. The record carries the request id of the context.
+func (s *loggingService) log(ctx context.Context, err error, args ...any) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+		args = append(args, "err", err)
+	}
+
+	s.logger.Log(ctx, level, "user call", args...)
+}
+
+// NewLoggingService returns a new instance of a logging Service. Passwords and tokens are never logged.
+func NewLoggingService(logger *slog.Logger, s Service) Service {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &loggingService{logger: logger, next: s}
+}
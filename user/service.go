@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -14,7 +15,7 @@ const JwtSigningSecret = "secret"
 
 var (
 	// ErrUserAlreadyExists is returned when an user registers with an existing nickname.
-	ErrUserAlreadyExists = errors.New("an user already exists with the nickname")
+	ErrUserAlreadyExists = messagerooms.ErrNicknameTaken
 
 	// ErrInvalidNickname returned when user tries to login with non existing nickname.
 	ErrInvalidNickname = errors.New("invalid nickname")
@@ -26,19 +27,21 @@ var (
 	ErrInvalidAccessToken = errors.New("invalid access token")
 )
 
-// Service is the interface that provides user related methods.
+// Service is the interface that provides user related methods. The storage is queried with the context of the call,
+// so the work of a cancelled request is cancelled too. The errors of the storage are returned as they are, they wrap
+// one of the error kinds of the messagerooms package.
 type Service interface {
 	// NewUser creates a new user.
-	NewUser(nickname, password string) (*messagerooms.User, error)
+	NewUser(ctx context.Context, nickname, password string) (*messagerooms.User, error)
 
 	// Login checks for valid nickname and password and returns the user.
-	Login(nickname, password string) (*messagerooms.User, error)
+	Login(ctx context.Context, nickname, password string) (*messagerooms.User, error)
 
 	// GenerateAuthToken generates an authentication token for the user. This is used after successful login.
-	GenerateAuthToken(user messagerooms.User) (string, error)
+	GenerateAuthToken(ctx context.Context, user messagerooms.User) (string, error)
 
 	// VerifyAuthToken for valid authentication token.
-	VerifyAuthToken(token string) (*messagerooms.User, error)
+	VerifyAuthToken(ctx context.Context, token string) (*messagerooms.User, error)
 }
 
 // JWTClaims represents the JWT token payload
@@ -52,14 +55,18 @@ type userService struct {
 	user messagerooms.UserRepository
 }
 
-func (s *userService) NewUser(nickname, password string) (*messagerooms.User, error) {
-	_, err := s.user.FindByNickname(nickname)
+func (s *userService) NewUser(ctx context.Context, nickname, password string) (*messagerooms.User, error) {
+	_, err := s.user.FindByNickname(ctx, nickname)
 	if err == nil {
 		return nil, ErrUserAlreadyExists
 	}
 
+	if !errors.Is(err, messagerooms.ErrNotFound) {
+		return nil, err
+	}
+
 	var user *messagerooms.User
-	user, err = s.user.Create(nickname, password)
+	user, err = s.user.Create(ctx, nickname, password)
 
 	if err != nil {
 		return nil, err
@@ -68,12 +75,16 @@ func (s *userService) NewUser(nickname, password string) (*messagerooms.User, er
 	return user, nil
 }
 
-func (s *userService) Login(nickname, password string) (*messagerooms.User, error) {
-	user, err := s.user.FindByNickname(nickname)
-	if err != nil {
+func (s *userService) Login(ctx context.Context, nickname, password string) (*messagerooms.User, error) {
+	user, err := s.user.FindByNickname(ctx, nickname)
+	if errors.Is(err, messagerooms.ErrNotFound) {
 		return nil, ErrInvalidNickname
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
 	// passwords are not encrypted, so just string matching
 	if user.Password != password {
 		return nil, ErrInvalidPassword
@@ -82,7 +93,7 @@ func (s *userService) Login(nickname, password string) (*messagerooms.User, erro
 	return user, nil
 }
 
-func (s *userService) GenerateAuthToken(user messagerooms.User) (string, error) {
+func (s *userService) GenerateAuthToken(ctx context.Context, user messagerooms.User) (string, error) {
 	jwtKey := []byte(JwtSigningSecret)
 	expirationTime := time.Now().Add(time.Hour * 24 * 365) // valid for one year
 
@@ -99,7 +110,7 @@ func (s *userService) GenerateAuthToken(user messagerooms.User) (string, error)
 	return token.SignedString(jwtKey)
 }
 
-func (s *userService) VerifyAuthToken(token string) (*messagerooms.User, error) {
+func (s *userService) VerifyAuthToken(ctx context.Context, token string) (*messagerooms.User, error) {
 	jwtKey := []byte(JwtSigningSecret)
 
 	claims := &JWTClaims{}
@@ -115,11 +126,15 @@ func (s *userService) VerifyAuthToken(token string) (*messagerooms.User, error)
 		return nil, ErrInvalidAccessToken
 	}
 
-	u, err := s.user.FindByID(claims.UserID)
-	if err != nil {
+	u, err := s.user.FindByID(ctx, claims.UserID)
+	if errors.Is(err, messagerooms.ErrNotFound) {
 		return nil, ErrInvalidAccessToken
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
 	return u, nil
 }
 
@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iamsayantan/messagerooms"
+	"github.com/iamsayantan/messagerooms/inmem"
+)
+
+func newTestService() Service {
+	return NewService(inmem.NewUserRepository(inmem.NewDB()))
+}
+
+func TestNewUserRejectsTakenNickname(t *testing.T) {
+	s := newTestService()
+
+	if _, err := s.NewUser(t.Context(), "alice", "secret"); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	if _, err := s.NewUser(t.Context(), "alice", "other"); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("creating user with a taken nickname: err = %v, want %v", err, ErrUserAlreadyExists)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestService()
+
+	created, err := s.NewUser(t.Context(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	user, err := s.Login(t.Context(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	if user.ID != created.ID {
+		t.Errorf("logged in as %s, want %s", user.ID, created.ID)
+	}
+
+	if _, err := s.Login(t.Context(), "alice", "wrong"); err != ErrInvalidPassword {
+		t.Errorf("logging in with a wrong password: err = %v, want %v", err, ErrInvalidPassword)
+	}
+
+	if _, err := s.Login(t.Context(), "bob", "secret"); err != ErrInvalidNickname {
+		t.Errorf("logging in with an unknown nickname: err = %v, want %v", err, ErrInvalidNickname)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	s := newTestService()
+
+	created, err := s.NewUser(t.Context(), "alice", "secret")
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	token, err := s.GenerateAuthToken(t.Context(), *created)
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+
+	user, err := s.VerifyAuthToken(t.Context(), token)
+	if err != nil {
+		t.Fatalf("verifying token: %v", err)
+	}
+
+	if user.ID != created.ID {
+		t.Errorf("token verified for %s, want %s", user.ID, created.ID)
+	}
+
+	if _, err := s.VerifyAuthToken(t.Context(), token+"x"); err == nil {
+		t.Error("verifying a tampered token succeeded, want an error")
+	}
+
+	other := newTestService()
+	if _, err := other.VerifyAuthToken(t.Context(), token); err != ErrInvalidAccessToken {
+		t.Errorf("verifying the token of an unknown user: err = %v, want %v", err, ErrInvalidAccessToken)
+	}
+}
+
+func TestStorageFailuresAreNotCredentialErrors(t *testing.T) {
+	s := newTestService()
+
+	if _, err := s.NewUser(t.Context(), "alice", "secret"); err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := s.Login(ctx, "alice", "secret"); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("logging in with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+
+	if _, err := s.NewUser(ctx, "bob", "secret"); !errors.Is(err, messagerooms.ErrUnavailable) {
+		t.Errorf("creating user with a cancelled context: err = %v, want %v", err, messagerooms.ErrUnavailable)
+	}
+}
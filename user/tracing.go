@@ -0,0 +1,64 @@
+package user
+
+import (
+	"context"
+
+	"github.com/iamsayantan/messagerooms"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingService traces the calls to the user service. The spans join the trace of the context, and the repositories
+// are called with the context of the span.
+type tracingService struct {
+	tracer trace.Tracer
+	next   Service
+}
+
+func (s *tracingService) NewUser(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "user.NewUser")
+	defer func() { endSpan(span, err) }()
+
+	return s.next.NewUser(ctx, nickname, password)
+}
+
+func (s *tracingService) Login(ctx context.Context, nickname, password string) (user *messagerooms.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "user.Login")
+	defer func() { endSpan(span, err) }()
+
+	return s.next.Login(ctx, nickname, password)
+}
+
+func (s *tracingService) GenerateAuthToken(ctx context.Context, user messagerooms.User) (token string, err error) {
+	ctx, span := s.tracer.Start(ctx, "user.GenerateAuthToken", trace.WithAttributes(
+		attribute.String("user.id", user.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.next.GenerateAuthToken(ctx, user)
+}
+
+func (s *tracingService) VerifyAuthToken(ctx context.Context, token string) (user *messagerooms.User, err error) {
+	ctx, span := s.tracer.Start(ctx, "user.VerifyAuthToken")
+	defer func() { endSpan(span, err) }()
+
+	return s.next.VerifyAuthToken(ctx, token)
+}
+
+// NewTracingService returns an instance of a tracing Service.
+func NewTracingService(tracer trace.Tracer, s Service) Service {
+	return &tracingService{
+		tracer: tracer,
+		next:   s,
+	}
+}
+
+// endSpan records the error of the traced call, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}